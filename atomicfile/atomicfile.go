@@ -0,0 +1,132 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package atomicfile replaces files so that a crash part way through
+// leaves either the old contents or the new, never a truncated file.
+//
+// The new contents are written to a temporary file in the same directory,
+// flushed to disk, and renamed over the original. Symlinks are followed, so
+// the file they point to is replaced rather than the link.
+package atomicfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// maxLinks is how many symlinks are followed before giving up
+const maxLinks = 40
+
+// WriteFile atomically replaces the named file with data. If the file
+// doesn't exist it is created with permissions perm (before umask);
+// otherwise its permissions are kept.
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	return Write(name, bytes.NewReader(data), perm)
+}
+
+// Write atomically replaces the named file with what src writes. If the
+// file doesn't exist it is created with permissions perm (before umask);
+// otherwise its permissions are kept.
+func Write(name string, src io.WriterTo, perm os.FileMode) error {
+	target, err := resolve(name)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(target)
+	exists := err == nil
+	if exists {
+		perm = fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, base := filepath.Split(target)
+	f, tmp, err := create(dir, base, perm)
+	if err != nil {
+		return err
+	}
+	if err := fill(f, src); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// the umask may have taken bits away from the original's permissions
+	if exists {
+		if err := os.Chmod(tmp, perm); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// resolve follows the symlinks at name to the file they lead to, which
+// need not exist
+func resolve(name string) (string, error) {
+	for i := 0; i < maxLinks; i++ {
+		fi, err := os.Lstat(name)
+		if os.IsNotExist(err) {
+			return name, nil
+		} else if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return name, nil
+		}
+		link, err := os.Readlink(name)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(name), link)
+		}
+		name = link
+	}
+	return "", fmt.Errorf("atomicfile: too many links resolving %s", name)
+}
+
+// create makes a new temporary file next to base in dir
+func create(dir, base string, perm os.FileMode) (*os.File, string, error) {
+	for i := 0; ; i++ {
+		tmp := filepath.Join(dir, fmt.Sprintf(".%s.%d%d~", base, os.Getpid(), rand.Uint32()))
+		f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return f, tmp, err
+	}
+}
+
+// fill writes src to f, flushes it to disk and closes it
+func fill(f *os.File, src io.WriterTo) error {
+	if _, err := src.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes the rename to disk. Not every system can sync a
+// directory, so errors are ignored.
+func syncDir(dir string) {
+	if dir == "" {
+		dir = "."
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
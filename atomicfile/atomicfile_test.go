@@ -0,0 +1,62 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file")
+
+	if err := WriteFile(name, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "new" {
+		t.Errorf("Wrote %q", got)
+	}
+
+	os.Chmod(name, 0751)
+	if err := WriteFile(name, []byte("replaced"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(name)
+	if fi.Mode().Perm() != 0751 {
+		t.Errorf("Mode changed to %v", fi.Mode())
+	}
+	if got, _ := os.ReadFile(name); string(got) != "replaced" {
+		t.Errorf("Wrote %q", got)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Left %d files behind", len(entries))
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file")
+	link := filepath.Join(dir, "link")
+	os.WriteFile(name, []byte("old"), 0644)
+	os.Symlink("file", link)
+
+	if err := WriteFile(link, []byte("through the link"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Lstat(link)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Link was replaced")
+	}
+	if got, _ := os.ReadFile(name); string(got) != "through the link" {
+		t.Errorf("Target holds %q", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "missing", "file")
+	if err := WriteFile(name, []byte("x"), 0644); err == nil {
+		t.Errorf("Wrote into a directory that doesn't exist")
+	}
+}
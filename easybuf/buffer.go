@@ -2,17 +2,11 @@ package easybuf
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
-	"log"
-	"os"
-)
 
-func init() {
-	bufLog, _ := os.Create("buflog.txt")
-	log.SetOutput(bufLog)
-}
+	"github.com/millere/jk/atomicfile"
+)
 
 // A Buffer is a direct array of bytes.
 // Insertion is therefor O(n).
@@ -31,10 +25,7 @@ func (b *Buffer) Load(from io.Reader, name string) error {
 		return fmt.Errorf("buffer.Load: %d bytes read, %v", n, err)
 	}
 	b.content = buf.Bytes()
-	log.Println(buf.Bytes())
-	log.Println(bytes.Count(b.content, []byte{'\n'}))
 	return nil
-
 }
 
 // GetLine returns the nth line in the buffer, 0 indexed
@@ -66,30 +57,21 @@ func (b Buffer) Lines() int {
 	return 0
 }
 
+// Write atomically replaces the named file, or the file the buffer was
+// loaded from if name is empty, with the buffer's contents
 func (b Buffer) Write(name string) error {
 	if name == "" {
 		name = b.fname
 	}
-	out, err := os.Create(name)
-	if err != nil {
-		panic(err.Error() + name)
-	}
-	total := 0
-	for total != len(b.content) {
-		n, err := out.Write(b.content[total:])
-		if err != nil {
-			return err
-		}
-		total += n
-	}
-	return nil
+	return atomicfile.WriteFile(name, b.content, 0666)
 }
 
 // WriteAt implements the io.WriterAt interface
 func (b *Buffer) WriteAt(p []byte, off int64) (int, error) {
-	b.content = append(
-		b.content[:off],
-		append(p, b.content[off:]...)...)
+	// p belongs to the caller, so it mustn't be appended to
+	b.content = append(b.content, p...)
+	copy(b.content[off+int64(len(p)):], b.content[off:])
+	copy(b.content[off:], p)
 	return len(p), nil
 }
 
@@ -140,7 +122,7 @@ func (b Buffer) Len() int {
 }
 
 func (b Buffer) Get() (string, error) {
-	return "", errors.New("easybuf.Buffer.Get(): Unimplemented")
+	return string(b.content), nil
 }
 
 func (b Buffer) FromTo(off1, off2 int64) (string, error) {
@@ -6,10 +6,14 @@
 package editor
 
 import (
+	"bytes"
+	"fmt"
 	"io"
-	"os"
 
 	"github.com/millere/jk/easybuf"
+	"github.com/millere/jk/gapbuf"
+	"github.com/millere/jk/piecetable"
+	"github.com/millere/jk/rope"
 )
 
 type WriteBuffer interface {
@@ -30,13 +34,55 @@ type Buffer interface {
 	OffsetOf(line, column int) int64
 }
 
+// Backends holds constructors for the available WriteBuffer implementations,
+// by the name they are selected with
+var Backends = map[string]func() WriteBuffer{
+	"easybuf":    func() WriteBuffer { return new(easybuf.Buffer) },
+	"gapbuf":     func() WriteBuffer { return gapbuf.New(0) },
+	"piecetable": func() WriteBuffer { return piecetable.New() },
+	"rope":       func() WriteBuffer { return rope.New() },
+}
+
+// DefaultBackend is the name of the backend BufferizeFile uses.
+// The rope finds lines in logarithmic time, which keeps redraws cheap.
+const DefaultBackend = "rope"
+
+// NewBuffer returns an empty buffer of the named backend
+func NewBuffer(backend string) (WriteBuffer, error) {
+	mk, ok := Backends[backend]
+	if !ok {
+		return nil, fmt.Errorf("No such buffer backend: %s", backend)
+	}
+	return mk(), nil
+}
+
 // BufferizeFile returns a Buffer initialized with a file
 func BufferizeFile(fname string) (WriteBuffer, error) {
-	b := new(easybuf.Buffer)
-	f, err := os.Open(fname)
+	return BufferizeFileWith(fname, DefaultBackend)
+}
+
+// BufferizeFileWith returns a Buffer of the named backend initialized with a file.
+// The file's line endings are detected, and lines are held ending in '\n'.
+// If the undo history saved with the file matches its contents, it is restored.
+func BufferizeFileWith(fname, backend string) (WriteBuffer, error) {
+	b, err := NewBuffer(backend)
+	if err != nil {
+		return nil, err
+	}
+	raw, st, err := readStamped(fname)
 	if err != nil {
 		return nil, err
 	}
-	err = b.Load(f, fname)
-	return b, err
+	format := detectFormat(raw)
+	if err := b.Load(bytes.NewReader(format.decode(raw)), fname); err != nil {
+		return nil, err
+	}
+	d := newDocument(b)
+	d.path = fname
+	d.format = format
+	d.disk = st
+	if err := d.loadHistory(fname, st.sum[:]); err != nil {
+		LogItAll.Println(err)
+	}
+	return d, nil
 }
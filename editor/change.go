@@ -0,0 +1,53 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+// A Change describes an edit to a buffer: Deleted bytes were removed from
+// Off, and Inserted put there in their place. Reloading a large file
+// replaces all of its text without reading it, so Replaced is then set,
+// Deleted is the old length and the new text has to be read from the
+// buffer. Positions in a replaced text are kept where they were, as far as
+// its new length allows, since a reloaded file has usually only grown.
+type Change struct {
+	Off      int64
+	Deleted  int64
+	Inserted []byte
+	Replaced bool
+}
+
+// A subscriber is a function that is told about changes to a document
+type subscriber struct {
+	f func(Change)
+}
+
+// Subscribe has f called with every change made to the document, whether
+// by editing, undoing or reloading, after the change is made. Subscribers
+// are called in the order they subscribed. Subscribe returns a function
+// that cancels the subscription.
+func (d *document) Subscribe(f func(Change)) (cancel func()) {
+	s := &subscriber{f}
+	d.subscribers = append(d.subscribers, s)
+	return func() {
+		for i, t := range d.subscribers {
+			if t == s {
+				d.subscribers = append(d.subscribers[:i:i], d.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify tells the document's subscribers about c
+func (d *document) notify(c Change) {
+	for _, s := range d.subscribers {
+		s.f(c)
+	}
+}
+
+// Subscribe has f called with every change made to the view's buffer, and
+// returns a function that cancels the subscription
+func (v *View) Subscribe(f func(Change)) (cancel func()) {
+	return v.buffer.back.Subscribe(f)
+}
@@ -0,0 +1,52 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	d := getDocument("hello world")
+	var got []Change
+	cancel := d.Subscribe(func(c Change) {
+		got = append(got, c)
+	})
+	d.WriteAt([]byte(","), 5)
+	d.Delete(6, 6)
+	d.Undo()
+	cancel()
+	d.Undo()
+
+	want := []Change{
+		{Off: 5, Inserted: []byte(",")},
+		{Off: 6, Deleted: 6},
+		{Off: 6, Inserted: []byte(" world")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got changes %v, expected %v", got, want)
+	}
+}
+
+func TestViewsFollowEdits(t *testing.T) {
+	e := &Editor{modes: make(map[string]*Mode), options: DefaultOptions()}
+	normal := Mode{}
+	e.modes["normal"] = &normal
+	d := getDocument("one\ntwo\nthree\n")
+	v, _ := e.ViewWithBuffer(d, "normal", 0, 0, 80, 24)
+	w, _ := e.ViewWithBuffer(d, "normal", 0, 0, 80, 24)
+	w.SetCursor(2, 1)
+
+	v.InsertChar('\n')
+	v.InsertChar('x')
+	if v.buffer.C != (Cursor{1, 1}) {
+		t.Errorf("Typing view's cursor is at %v", v.buffer.C)
+	}
+	if w.buffer.C != (Cursor{3, 1}) {
+		t.Errorf("Other view's cursor is at %v, expected it to follow \"three\"", w.buffer.C)
+	}
+	d.Undo()
+	d.Undo()
+	if w.buffer.C != (Cursor{2, 1}) {
+		t.Errorf("After undoing, other view's cursor is at %v", w.buffer.C)
+	}
+}
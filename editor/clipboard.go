@@ -0,0 +1,108 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Clipboard and Selection are the names of the register that holds the
+// system clipboard
+const (
+	Clipboard = "+"
+	Selection = "*"
+)
+
+// The clipboard register writes to the system clipboard through a helper
+// command such as xclip or wl-copy, if one is set, and otherwise through
+// the terminal with an OSC 52 escape sequence, which works over SSH.
+// Terminals seldom let programs read the clipboard, so without a paste
+// helper the register gives back what was last written to it.
+type clipboard struct {
+	copy     string    // the command that reads text to copy on its input
+	paste    string    // the command that writes the clipboard on its output
+	terminal io.Writer // where OSC 52 sequences go
+	last     register
+}
+
+// isClipboard reports whether name is a name of the clipboard register
+func isClipboard(name string) bool {
+	return name == Clipboard || name == Selection
+}
+
+// osc52 returns the escape sequence that puts text on the clipboard
+func osc52(text string) string {
+	return "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+}
+
+// helper returns the command line s as a command
+func helper(s string) *exec.Cmd {
+	parts := strings.Fields(s)
+	return exec.Command(parts[0], parts[1:]...)
+}
+
+func (c *clipboard) write(reg register) error {
+	switch {
+	case c.copy != "":
+		if err := c.runCopy(reg.text); err != nil {
+			return err
+		}
+	case c.terminal != nil:
+		if _, err := io.WriteString(c.terminal, osc52(reg.text)); err != nil {
+			return fmt.Errorf("clipboard: %v", err)
+		}
+	default:
+		return errors.New("clipboard: no terminal or copy command")
+	}
+	c.last = reg
+	return nil
+}
+
+// runCopy gives text to the copy helper. Helpers like xclip and wl-copy
+// leave a process behind that holds the clipboard, and it would keep any
+// output pipe open, so the helper's errors go to a file instead.
+func (c *clipboard) runCopy(text string) error {
+	errs, err := os.CreateTemp("", "jk-clipboard-")
+	if err != nil {
+		return fmt.Errorf("clipboard: %v", err)
+	}
+	defer os.Remove(errs.Name())
+	defer errs.Close()
+
+	cmd := helper(c.copy)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = errs
+	if err := cmd.Run(); err != nil {
+		msg, _ := os.ReadFile(errs.Name())
+		return fmt.Errorf("clipboard: %s: %v %s", c.copy, err, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (c *clipboard) read() (register, error) {
+	if c.paste == "" {
+		if c.last.text == "" {
+			return register{}, errors.New("clipboard: no paste command, and nothing copied")
+		}
+		return c.last, nil
+	}
+	out, err := helper(c.paste).Output()
+	if err != nil {
+		return register{}, fmt.Errorf("clipboard: %s: %v", c.paste, err)
+	}
+	text := string(out)
+	if text == c.last.text {
+		return c.last, nil
+	}
+	// text from other programs is linewise if it is made of whole lines
+	return register{text, strings.HasSuffix(text, "\n")}, nil
+}
@@ -0,0 +1,99 @@
+package editor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClipboardOSC52(t *testing.T) {
+	v := cursorView(t, "one\ntwo\n")
+	var term bytes.Buffer
+	v.parent.registers.clipboard.terminal = &term
+	if err := v.Yank(Clipboard); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := term.String(), "\x1b]52;c;b25lCg==\a"; got != want {
+		t.Errorf("Yanking to the clipboard wrote %q, want %q", got, want)
+	}
+	v.SetCursor(1, 0)
+	if err := v.Put(Selection, true, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(v.buffer.back); got != "one\ntwo\none\n" {
+		t.Errorf("Putting from the clipboard without a paste command gave %q", got)
+	}
+}
+
+func TestClipboardHelpers(t *testing.T) {
+	dir := t.TempDir()
+	clip := filepath.Join(dir, "clip")
+	copyCmd, pasteCmd := filepath.Join(dir, "copy"), filepath.Join(dir, "paste")
+	os.WriteFile(copyCmd, []byte("#!/bin/sh\ncat > "+clip+"\n"), 0755)
+	os.WriteFile(pasteCmd, []byte("#!/bin/sh\ncat "+clip+"\n"), 0755)
+
+	v := cursorView(t, "one two\n")
+	e := v.parent
+	var term bytes.Buffer
+	e.registers.clipboard.terminal = &term
+	e.SetOption("clipboard-copy", copyCmd)
+	e.SetOption("clipboard-paste", pasteCmd)
+
+	v.SetPoint()
+	v.SetCursor(0, 2)
+	if err := v.DeleteSelection(Clipboard); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(clip); string(got) != "one" {
+		t.Errorf("The copy command got %q, want %q", got, "one")
+	}
+	if term.Len() != 0 {
+		t.Errorf("Wrote %q to the terminal with a copy command set", term.String())
+	}
+
+	os.WriteFile(clip, []byte("new\n"), 0644)
+	if err := v.Put(Clipboard, true, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(v.buffer.back); got != " two\nnew\n" {
+		t.Errorf("Putting whole lines from the paste command gave %q", got)
+	}
+
+	e.SetOption("clipboard-copy", filepath.Join(dir, "missing"))
+	if err := v.Yank(Clipboard); err == nil {
+		t.Errorf("Yanking with a missing copy command didn't fail")
+	}
+}
+
+func TestClipboardHelperLeavesProcess(t *testing.T) {
+	dir := t.TempDir()
+	copyCmd := filepath.Join(dir, "copy")
+	// like xclip, keep holding the clipboard in the background
+	os.WriteFile(copyCmd, []byte("#!/bin/sh\ncat > /dev/null\nsleep 5 &\n"), 0755)
+
+	v := cursorView(t, "one\n")
+	v.parent.SetOption("clipboard-copy", copyCmd)
+	start := time.Now()
+	if err := v.Yank(Clipboard); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Yanking waited %v for the copy command's background process", d)
+	}
+}
+
+func TestClipboardHelperErrors(t *testing.T) {
+	dir := t.TempDir()
+	copyCmd := filepath.Join(dir, "copy")
+	os.WriteFile(copyCmd, []byte("#!/bin/sh\necho no display >&2\nexit 1\n"), 0755)
+
+	v := cursorView(t, "one\n")
+	v.parent.SetOption("clipboard-copy", copyCmd)
+	err := v.Yank(Clipboard)
+	if err == nil || !strings.Contains(err.Error(), "no display") {
+		t.Errorf("Yanking with a failing copy command gave %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A selection is a cursor besides a subview's main one, along with its own
+// point. Both are marks, so they follow edits.
+type selection struct {
+	at    *mark
+	point *mark // nil if the cursor has no selection
+}
+
+// addCursor adds a cursor at off, unless there's one there already, and
+// returns it
+func (s *subview) addCursor(off int64) *selection {
+	if off == s.offsetOf(s.C) {
+		return nil
+	}
+	for _, x := range s.extra {
+		if x.at.off == off {
+			return nil
+		}
+	}
+	x := &selection{at: s.back.newMark(off)}
+	s.extra = append(s.extra, x)
+	return x
+}
+
+// dropCursors removes every cursor but the main one
+func (s *subview) dropCursors() {
+	for _, x := range s.extra {
+		s.dropSelection(x)
+	}
+	s.extra = nil
+}
+
+func (s *subview) dropSelection(x *selection) {
+	s.back.dropMark(x.at)
+	if x.point != nil {
+		s.back.dropMark(x.point)
+	}
+}
+
+// merge removes cursors that edits have moved onto the same place as
+// another
+func (s *subview) merge() {
+	seen := map[int64]bool{s.offsetOf(s.C): true}
+	kept := s.extra[:0]
+	for _, x := range s.extra {
+		if seen[x.at.off] {
+			s.dropSelection(x)
+			continue
+		}
+		seen[x.at.off] = true
+		kept = append(kept, x)
+	}
+	s.extra = kept
+}
+
+// clamp returns the position nearest row and column that exists
+func (s *subview) clamp(row, column int) Cursor {
+	if s.back.Len() == 0 {
+		return Cursor{0, 0}
+	}
+	if total := s.back.Lines(); row >= total {
+		row = total - 1
+	}
+	if row < 0 {
+		row = 0
+	}
+	line, _ := s.back.GetLine(row)
+	if l := columns(line); column > l {
+		column = l
+	}
+	if column < 0 {
+		column = 0
+	}
+	return Cursor{row, column}
+}
+
+// moveCursors moves the cursors besides the main one like MoveCursor. They
+// should be merged once the main cursor has moved too.
+func (s *subview) moveCursors(dc, dr int) {
+	for _, x := range s.extra {
+		c := s.cursorAt(x.at.off)
+		x.at.off = s.offsetOf(s.clamp(c.Line+dr, c.Column+dc))
+	}
+}
+
+// deleteBefore deletes the character before off, and returns where it was
+func (s *subview) deleteBefore(off int64) int64 {
+	if off < 1 {
+		return off
+	}
+	c := s.cursorAt(off)
+	prev := Cursor{c.Line, c.Column - 1}
+	if prev.Column < 0 {
+		// join with the previous line by deleting its newline
+		prev = s.cursorAt(off - 1)
+	}
+	start := s.offsetOf(prev)
+	s.back.Delete(off-start, start)
+	return start
+}
+
+// ordered returns the offsets of the first and last bytes of the main
+// selection, whichever way round the point and cursor are
+func (s *subview) ordered() (int64, int64, bool) {
+	start, end, ok := s.region()
+	if start > end {
+		start, end = end, start
+	}
+	return start, end, ok
+}
+
+// wordAt returns the offsets of the start and end of the word around off
+func wordAt(text string, off int) (int, int) {
+	isWord := func(r byte) bool {
+		return r == '_' || r >= 0x80 || unicode.IsLetter(rune(r)) || unicode.IsDigit(rune(r))
+	}
+	start, end := off, off
+	for start > 0 && isWord(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isWord(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+// extraCursors returns the offsets of the cursors besides the main one, and
+// a function reporting whether an offset is in one of their selections
+func (s *subview) extraCursors() (map[int64]bool, func(off int64) bool) {
+	at := make(map[int64]bool)
+	for _, x := range s.extra {
+		at[x.at.off] = true
+	}
+	return at, func(off int64) bool {
+		for _, x := range s.extra {
+			if x.point != nil && x.point.off <= off && off <= x.at.off {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AddCursorAtNextMatch adds a cursor at the next place after the last cursor
+// where the selected text, or the word under the cursor, appears again. If
+// there is a selection, the new cursor selects the match too.
+func (v *View) AddCursorAtNextMatch() error {
+	s := v.target
+	text, err := s.back.Get()
+	if err != nil {
+		return err
+	}
+	cur := s.offsetOf(s.C)
+	start, end, selecting := s.ordered()
+	var rel int64
+	if selecting {
+		end++
+	} else {
+		st, en := wordAt(text, int(cur))
+		start, end, rel = int64(st), int64(en), cur-int64(st)
+	}
+	if start == end || end > int64(len(text)) {
+		return errors.New("Nothing to match")
+	}
+	needle := text[start:end]
+
+	last := cur
+	if len(s.extra) > 0 {
+		last = s.extra[len(s.extra)-1].at.off
+	}
+	var matches []int64
+	for i := 0; ; {
+		j := strings.Index(text[i:], needle)
+		if j == -1 {
+			break
+		}
+		matches = append(matches, int64(i+j))
+		i += j + 1
+	}
+	// look after the last cursor first, then from the top
+	first := sort.Search(len(matches), func(i int) bool { return matches[i] > last-rel })
+	for i := range matches {
+		m := matches[(first+i)%len(matches)]
+		if m == start {
+			continue
+		}
+		if !selecting {
+			if s.addCursor(m+rel) != nil {
+				return nil
+			}
+		} else if x := s.addCursor(m + int64(len(needle)) - 1); x != nil {
+			x.point = s.back.newMark(m)
+			return nil
+		}
+	}
+	return errors.New("No more matches for " + needle)
+}
+
+// AddCursorsOnLines turns the selection into a cursor on each of its lines,
+// in the main cursor's column
+func (v *View) AddCursorsOnLines() error {
+	s := v.target
+	start, end, ok := s.ordered()
+	if !ok {
+		return errors.New("No selection")
+	}
+	first, last := s.cursorAt(start).Line, s.cursorAt(end).Line
+	for l := first; l <= last; l++ {
+		if l != s.C.Line {
+			s.addCursor(s.offsetOf(s.clamp(l, s.C.Column)))
+		}
+	}
+	v.ClearPoint()
+	return nil
+}
+
+// SingleCursor removes every cursor but the main one
+func (v *View) SingleCursor() {
+	v.target.dropCursors()
+}
+
+// Click moves the cursor of the current view to the cell clicked at x, y on
+// the screen, or adds a cursor there if add is true. Clicks outside the
+// view's buffer, on its tag line or status bar, are ignored.
+func (e *Editor) Click(x, y int, add bool) {
+	if e.currentView == -1 {
+		return
+	}
+	v := e.views[e.currentView]
+	s := v.buffer
+	if !s.onScreen(x, y) {
+		return
+	}
+	c := s.cursorAtCell(x-s.x, y-s.y)
+	v.target = s
+	if add {
+		s.addCursor(s.offsetOf(c))
+		return
+	}
+	v.SetCursor(c.Line, c.Column)
+}
@@ -0,0 +1,115 @@
+package editor
+
+import "testing"
+
+func cursorView(t *testing.T, text string) *View {
+	e := testEditor()
+	v, err := e.ViewWithBuffer(getDocument(text), "normal", 0, 0, 80, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &v
+}
+
+func TestCursorsOnLines(t *testing.T) {
+	v := cursorView(t, "one\ntwo\nthree\n")
+	v.SetCursor(0, 1)
+	v.SetPoint()
+	v.SetCursor(2, 1)
+	if err := v.AddCursorsOnLines(); err != nil {
+		t.Fatal(err)
+	}
+	v.InsertChar('-')
+	v.MoveCursor(1, 0)
+	v.InsertChar('+')
+	if got := contents(v.buffer.back); got != "o-n+e\nt-w+o\nt-h+ree\n" {
+		t.Errorf("Typing with a cursor on each line gave %q", got)
+	}
+	v.DeleteBackwards()
+	v.DeleteBackwards()
+	if got := contents(v.buffer.back); got != "o-e\nt-o\nt-ree\n" {
+		t.Errorf("Deleting with a cursor on each line gave %q", got)
+	}
+	v.MoveCursor(-5, 0)
+	if len(v.buffer.extra) != 2 {
+		t.Errorf("Got %d extra cursors after moving to the start of each line", len(v.buffer.extra))
+	}
+	v.DeleteBackwards()
+	if got := contents(v.buffer.back); got != "o-et-ot-ree\n" {
+		t.Errorf("Deleting at the start of each line gave %q", got)
+	}
+	v.SingleCursor()
+	if len(v.buffer.extra) != 0 || len(v.buffer.back.marks) != 1 {
+		t.Errorf("Cursors left after dropping them: %d, %d marks", len(v.buffer.extra), len(v.buffer.back.marks))
+	}
+}
+
+func TestCursorsCollide(t *testing.T) {
+	v := cursorView(t, "ab\ncd")
+	v.SetCursor(0, 1)
+	v.SetPoint()
+	v.SetCursor(1, 1)
+	if err := v.AddCursorsOnLines(); err != nil {
+		t.Fatal(err)
+	}
+	v.MoveCursor(0, -1)
+	if len(v.buffer.extra) != 0 {
+		t.Errorf("Got %d extra cursors after moving the main one onto the other", len(v.buffer.extra))
+	}
+	v.InsertChar('x')
+	if got := contents(v.buffer.back); got != "axb\ncd" {
+		t.Errorf("Typing after the cursors met gave %q", got)
+	}
+}
+
+func TestCursorAtNextMatch(t *testing.T) {
+	v := cursorView(t, "foo bar foo baz foo")
+	v.SetCursor(0, 1)
+	for i := 0; i < 2; i++ {
+		if err := v.AddCursorAtNextMatch(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.AddCursorAtNextMatch(); err == nil {
+		t.Error("Added a cursor when every match had one")
+	}
+	v.InsertChar('X')
+	if got := contents(v.buffer.back); got != "fXoo bar fXoo baz fXoo" {
+		t.Errorf("Got %q", got)
+	}
+
+	v = cursorView(t, "a.b a.b a.b")
+	v.SetCursor(0, 4)
+	v.SetPoint()
+	v.SetCursor(0, 6)
+	v.AddCursorAtNextMatch()
+	v.AddCursorAtNextMatch()
+	if len(v.buffer.extra) != 2 {
+		t.Fatalf("Got %d extra cursors", len(v.buffer.extra))
+	}
+	for _, x := range v.buffer.extra {
+		if x.point == nil || x.point.off+2 != x.at.off {
+			t.Errorf("Extra cursor at %d doesn't select the match", x.at.off)
+		}
+	}
+	if got := v.buffer.extra[1].point.off; got != 0 {
+		t.Errorf("Search didn't wrap around: second match is at %d", got)
+	}
+}
+
+func TestClick(t *testing.T) {
+	v := cursorView(t, "one\ntwo\n")
+	e := v.parent
+	e.addView(v)
+	e.Click(2, 2, false)
+	if v.buffer.C != (Cursor{1, 2}) {
+		t.Errorf("Clicking the third cell of the second line put the cursor at %v", v.buffer.C)
+	}
+	// the tag line, past the right edge, and the status bar
+	for _, cell := range [][2]int{{1, 0}, {80, 1}, {0, 23}} {
+		e.Click(cell[0], cell[1], true)
+		if v.buffer.C != (Cursor{1, 2}) || len(v.buffer.extra) != 0 {
+			t.Errorf("Clicking %v outside the buffer moved the cursor to %v with %d more", cell, v.buffer.C, len(v.buffer.extra))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+)
+
+// A fileStamp identifies the contents of a file at some moment, so that
+// changes made to it by other programs can be noticed
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	sum     [sha256.Size]byte
+	known   bool // false if nothing has been read from or written to the file
+	// unsummed is true if the file was too large to hash, so that any
+	// change to its size or modification time counts as a change
+	unsummed bool
+}
+
+// readStamped reads the named file, returning its contents and their stamp
+func readStamped(name string) ([]byte, fileStamp, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fileStamp{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fileStamp{}, err
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(f); err != nil {
+		return nil, fileStamp{}, err
+	}
+	return buf.Bytes(), stamp(fi, buf.Bytes()), nil
+}
+
+// stamp returns the stamp of a file with info fi and contents raw
+func stamp(fi os.FileInfo, raw []byte) fileStamp {
+	return fileStamp{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		sum:     sha256.Sum256(raw),
+		known:   true,
+	}
+}
+
+// changedOnDisk reports whether the named file's contents differ from
+// those the document last read or wrote. A file that has been touched but
+// still holds the same contents hasn't changed.
+func (d *document) changedOnDisk(name string) (bool, error) {
+	if !d.disk.known {
+		return false, nil
+	}
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if fi.Size() == d.disk.size && fi.ModTime().Equal(d.disk.modTime) {
+		return false, nil
+	}
+	if d.disk.unsummed {
+		return true, nil
+	}
+	_, now, err := readStamped(name)
+	if err != nil {
+		return false, err
+	}
+	if now.sum != d.disk.sum {
+		return true, nil
+	}
+	d.disk = now
+	return false, nil
+}
+
+// errChangedOnDisk is returned when saving would overwrite changes made to
+// a file by another program
+func errChangedOnDisk(name string) error {
+	return fmt.Errorf("%s has changed on disk since it was read: get reloads it, force-save overwrites it", name)
+}
+
+// Reload reloads the document from its file, as an edit that can be undone
+func (d *document) Reload() error {
+	if d.large {
+		return d.reloadLarge()
+	}
+	raw, st, err := readStamped(d.path)
+	if err != nil {
+		return err
+	}
+	format := detectFormat(raw)
+	d.replace(format.decode(raw))
+	d.format = format
+	d.disk = st
+	d.markClean()
+	return nil
+}
+
+// replace changes the text of the document to text, editing only the part
+// that differs
+func (d *document) replace(text []byte) {
+	old, _ := d.WriteBuffer.Get()
+	pre := 0
+	for pre < len(old) && pre < len(text) && old[pre] == text[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(old)-pre && suf < len(text)-pre &&
+		old[len(old)-1-suf] == text[len(text)-1-suf] {
+		suf++
+	}
+	d.history.Begin()
+	d.Delete(int64(len(old)-pre-suf), int64(pre))
+	d.WriteAt(text[pre:len(text)-suf], int64(pre))
+	d.history.End()
+}
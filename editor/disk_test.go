@@ -0,0 +1,52 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChangedOnDisk(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "file.txt")
+	os.WriteFile(name, []byte("one\ntwo\n"), 0644)
+
+	b, _ := BufferizeFile(name)
+	d := b.(*document)
+	d.WriteAt([]byte("zero\n"), 0)
+
+	// touching the file doesn't change it
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(name, later, later)
+	if err := d.Write(""); err != nil {
+		t.Fatalf("Saving a touched file: %v", err)
+	}
+
+	os.WriteFile(name, []byte("one\ntwo\nthree\n"), 0644)
+	if err := d.Write(""); err == nil {
+		t.Fatal("Saved over a file changed on disk")
+	}
+	if got, _ := os.ReadFile(name); string(got) != "one\ntwo\nthree\n" {
+		t.Errorf("File was overwritten with %q", got)
+	}
+
+	if err := d.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.Get(); got != "one\ntwo\nthree\n" {
+		t.Errorf("Reloaded %q", got)
+	}
+	if err := d.Write(""); err != nil {
+		t.Errorf("Saving after reloading: %v", err)
+	}
+	d.Undo()
+	if got, _ := d.Get(); got != "zero\none\ntwo\n" {
+		t.Errorf("Undoing the reload gave %q", got)
+	}
+
+	os.WriteFile(name, []byte("changed again\n"), 0644)
+	if err := d.ForceWrite(""); err != nil {
+		t.Errorf("Forcing a save: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/millere/jk/atomicfile"
+)
+
+// A document is a WriteBuffer along with what the editor keeps track of
+// about it. Edits made through a document are recorded in its history.
+type document struct {
+	WriteBuffer
+	history  history
+	path     string // the file the document was loaded from, if any
+	tabWidth int    // the number of cells between tab stops
+	format   fileFormat
+	edits    int // counts changes, so others can tell when it has changed
+	swap     swapState
+	disk     fileStamp        // the file as it was last read or written
+	conflict fileStamp        // the version of the file last warned about
+	clean    *state           // the history state the file holds
+	cleanLen int              // the length of clean's step when it was saved
+	large    bool             // whether the file is mapped rather than read
+	marks    []*mark          // every mark in the document, moved by each edit
+	named    map[string]*mark // the marks users have named
+
+	subscribers []*subscriber
+}
+
+func newDocument(b WriteBuffer) *document {
+	if d, ok := b.(*document); ok {
+		return d
+	}
+	d := &document{WriteBuffer: b, history: newHistory()}
+	d.markClean()
+	d.Subscribe(d.adjustMarks)
+	return d
+}
+
+// Write writes the document to the named file, or the file it was loaded
+// from if name is empty, in the document's format. The file is replaced
+// atomically, and the document's history is saved to go with it. Write
+// refuses to overwrite changes another program made to the document's file.
+func (d *document) Write(name string) error {
+	return d.write(name, false)
+}
+
+// ForceWrite writes the document like Write, even if its file has changed
+func (d *document) ForceWrite(name string) error {
+	return d.write(name, true)
+}
+
+// SaveAs writes the document to the named file, creating any directories
+// it needs, and makes that the document's file from then on. It refuses to
+// overwrite a file that already exists.
+func (d *document) SaveAs(name string) error {
+	return d.saveAs(name, false)
+}
+
+// ForceSaveAs saves the document like SaveAs, even over an existing file
+func (d *document) ForceSaveAs(name string) error {
+	return d.saveAs(name, true)
+}
+
+func (d *document) saveAs(name string, force bool) error {
+	if name == d.path {
+		return d.write(name, force)
+	}
+	if _, err := os.Stat(name); err == nil && !force {
+		return fmt.Errorf("%s already exists: force-save-as overwrites it", name)
+	}
+	path, disk, swap := d.path, d.disk, d.swap
+	// the swap file belongs to the old file, and goes once the new one is
+	// written
+	d.path, d.disk, d.swap.exists = name, fileStamp{}, false
+	if err := d.write(name, force); err != nil {
+		d.path, d.disk, d.swap = path, disk, swap
+		return err
+	}
+	if swap.exists {
+		if old, err := swapName(path); err == nil {
+			os.Remove(old)
+		}
+	}
+	return nil
+}
+
+func (d *document) write(name string, force bool) error {
+	if name == "" {
+		name = d.path
+	}
+	if name == "" {
+		return d.WriteBuffer.Write(name)
+	}
+	if name == d.path && !force {
+		changed, err := d.changedOnDisk(name)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return errChangedOnDisk(name)
+		}
+	}
+	if name != d.path || !d.disk.known {
+		// the file is new, and so may be the directories it goes in
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			return err
+		}
+	}
+	if d.large {
+		return d.writeLarge(name)
+	}
+	text, err := d.Get()
+	if err != nil {
+		return err
+	}
+	raw, err := d.format.encode([]byte(text))
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(name, raw, 0666); err != nil {
+		return err
+	}
+	if name == d.path {
+		d.removeSwap()
+		if fi, err := os.Stat(name); err == nil {
+			d.disk = stamp(fi, raw)
+		}
+		d.markClean()
+	}
+	sum := sha256.Sum256(raw)
+	if err := d.saveHistory(name, sum[:]); err != nil {
+		LogItAll.Println("Saving history:", err)
+	}
+	return nil
+}
+
+// setFormat changes the format the document is saved in. Large documents
+// are saved straight from the file they map, so their format can't change.
+func (d *document) setFormat(f fileFormat) error {
+	if d.large && f != d.format {
+		return fmt.Errorf("%s is too large to convert, so it is saved as it is", d.path)
+	}
+	d.format = f
+	return nil
+}
+
+// WriteAt inserts p at off and records the edit
+func (d *document) WriteAt(p []byte, off int64) (int, error) {
+	n, err := d.WriteBuffer.WriteAt(p, off)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	ins := make([]byte, n)
+	copy(ins, p)
+	d.history.record(edit{off: off, inserted: ins})
+	d.edits++
+	d.notify(Change{Off: off, Inserted: ins})
+	return n, nil
+}
+
+// Delete deletes n bytes forwards from off and records the edit
+func (d *document) Delete(n, off int64) {
+	if n <= 0 {
+		return
+	}
+	s, err := d.FromTo(off, off+n-1)
+	if err != nil {
+		LogItAll.Println("document.Delete:", err)
+		return
+	}
+	d.WriteBuffer.Delete(n, off)
+	d.history.record(edit{off: off, deleted: []byte(s)})
+	d.edits++
+	d.notify(Change{Off: off, Deleted: n})
+}
+
+// Undo reverts the last step of the document's history, returning where
+// the change happened or -1 if there was nothing to undo
+func (d *document) Undo() int64 {
+	return d.travelled(d.history.undo(d.replay()))
+}
+
+// Redo reapplies the last undone step of the document's history,
+// returning where the change happened or -1 if there was nothing to redo
+func (d *document) Redo() int64 {
+	return d.travelled(d.history.redo(d.replay()))
+}
+
+// Older moves the document n states back in time, across branches
+func (d *document) Older(n int) int64 {
+	return d.travelled(d.history.older(d.replay(), n))
+}
+
+// Newer moves the document n states forward in time, across branches
+func (d *document) Newer(n int) int64 {
+	return d.travelled(d.history.newer(d.replay(), n))
+}
+
+// Earlier moves the document to the state it was in t before now
+func (d *document) Earlier(t time.Duration) int64 {
+	return d.travelled(d.history.earlier(d.replay(), t))
+}
+
+// Later moves the document to the state it was in t after now
+func (d *document) Later(t time.Duration) int64 {
+	return d.travelled(d.history.later(d.replay(), t))
+}
+
+// Jump moves the document to the state numbered seq
+func (d *document) Jump(seq int) int64 {
+	return d.travelled(d.history.jump(d.replay(), seq))
+}
+
+// modified reports whether the document has changed since it was last
+// read from or written to its file. Undoing back to that point makes it
+// unmodified again.
+func (d *document) modified() bool {
+	return d.history.cur != d.clean || len(d.clean.step) != d.cleanLen
+}
+
+// markClean notes that the document's text is what its file holds
+func (d *document) markClean() {
+	d.clean = d.history.cur
+	d.cleanLen = len(d.clean.step)
+}
+
+// travelled notes that a trip through the history changed the document at
+// off, unless off is -1, and returns off
+func (d *document) travelled(off int64) int64 {
+	if off != -1 {
+		d.edits++
+	}
+	return off
+}
+
+// cursorAt returns the cursor position of the byte offset off in b
+func cursorAt(b Buffer, off int64) Cursor {
+	lo, hi := 0, b.Lines()-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if start := b.OffsetOf(mid, 0); start != -1 && start <= off {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo < 0 {
+		return Cursor{0, 0}
+	}
+	line, _ := b.GetLine(lo)
+	return Cursor{lo, columnAt(line, int(off-b.OffsetOf(lo, 0)))}
+}
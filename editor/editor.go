@@ -6,10 +6,12 @@
 package editor
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/millere/jk/easybuf"
 	"github.com/millere/jk/keys"
@@ -19,6 +21,9 @@ import (
 // LogItAll logs _everything_
 var LogItAll *log.Logger
 
+// ErrQuit is returned by Do when the editor should exit
+var ErrQuit = errors.New("Quitting")
+
 // An Editor edits shit
 type Editor struct {
 	views          []*View
@@ -28,12 +33,27 @@ type Editor struct {
 	viewCommands   map[string]ModeFunc
 	log            *log.Logger
 	shouldQuit     bool
+	keypresses     int // how many keypresses Do has handled
+	quitRefused    int // the keypress Quit last refused to quit on
+	closeRefused   int // the keypress CloseView last refused to close on
+	options        Options
+	message        string // shown in the status bar until the next keypress
+	registers      registers
+	register       string // the register the next yank, deletion or put uses
+	events         chan Event
+	done           chan struct{} // closed by Close, to stop background work
+	watcher        watcher
 }
 
 // New creates and initializes a new editor
 func New() *Editor {
 	e := new(Editor)
 	e.modes = make(map[string]*Mode)
+	e.options = DefaultOptions()
+	e.events = make(chan Event, 16)
+	e.done = make(chan struct{})
+	e.registers.clipboard.terminal = os.Stdout
+	go e.tick(SwapInterval)
 
 	e.currentView = -1
 	e.buildStandardFuncs()
@@ -50,6 +70,19 @@ func (e *Editor) Draw() {
 		return
 	}
 	e.views[e.currentView].Draw()
+	if e.remapBroken() {
+		// what was drawn came from a file that has gone
+		e.views[e.currentView].Draw()
+	}
+}
+
+// InputMode returns the termbox input mode the editor wants, which reports
+// mouse clicks only if the mouse option is set
+func (e *Editor) InputMode() termbox.InputMode {
+	if e.options.Mouse {
+		return termbox.InputEsc | termbox.InputMouse
+	}
+	return termbox.InputEsc
 }
 
 func (e *Editor) NextView() {
@@ -58,34 +91,122 @@ func (e *Editor) NextView() {
 	}
 }
 
-// Do handles events
+// Do handles events. Errors are shown to the user, and only ErrQuit,
+// when the editor should exit, is returned.
 func (e *Editor) Do(k keys.Keypress) error {
 	//e.Log("Going to do", k)
 	if e.currentView == -1 {
 		e.Log("currentView is nil")
 		return errors.New("currentView is nil")
 	}
+	e.message = ""
+	e.keypresses++
 	err := e.views[e.currentView].Do(k)
-	if e.shouldQuit {
-		return errors.New("Quitting")
+	if e.shouldQuit || err == ErrQuit {
+		e.removeSwaps()
+		return ErrQuit
+	}
+	if err != nil {
+		e.Message(err)
+	}
+	e.remapBroken()
+	e.updateSwaps()
+	return nil
+}
+
+// Quit makes the editor exit after the current keypress. If any buffers
+// have unsaved changes, it refuses and lists them instead, unless it
+// refused on the keypress just before this one.
+func (e *Editor) Quit() error {
+	var dirty []string
+	for _, d := range e.documents() {
+		if d.modified() {
+			name := d.path
+			if name == "" {
+				name = "[no name]"
+			}
+			dirty = append(dirty, name)
+		}
+	}
+	if len(dirty) > 0 && e.quitRefused != e.keypresses-1 {
+		e.quitRefused = e.keypresses
+		return fmt.Errorf("Unsaved changes in %s: quit again to discard them", strings.Join(dirty, ", "))
+	}
+	e.Log("Quitting")
+	e.shouldQuit = true
+	return nil
+}
+
+// documents returns the documents shown in the editor's views
+func (e *Editor) documents() []*document {
+	var docs []*document
+	seen := make(map[*document]bool)
+	for _, v := range e.views {
+		if d := v.buffer.back; !seen[d] {
+			seen[d] = true
+			docs = append(docs, d)
+		}
+	}
+	return docs
+}
+
+// updateSwaps brings the swap files of modified buffers up to date
+func (e *Editor) updateSwaps() {
+	for _, d := range e.documents() {
+		if err := d.updateSwap(); err != nil {
+			e.Message("Writing swap file: ", err)
+		}
+	}
+}
+
+// removeSwaps removes the swap files the editor has written, which is done
+// when it exits normally
+func (e *Editor) removeSwaps() {
+	for _, d := range e.documents() {
+		d.removeSwap()
 	}
-	return err
 }
 
-// AddFile opens the file with the given name and gives it a view
+// Message shows a message in the status bar until the next keypress
+func (e *Editor) Message(things ...interface{}) {
+	e.message = fmt.Sprint(things...)
+	e.Log(things...)
+}
+
+// AddFile opens the file with the given name and gives it a view. A file
+// that doesn't exist is opened as an empty buffer, and created when it's
+// saved.
 func (e *Editor) AddFile(filename string) error {
 	w, h := termbox.Size()
 	e.Log("Adding file:", filename)
-	buffer, err := BufferizeFile(filename)
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		v, err := e.newFileView(filename)
+		if err == nil && v.buffer.back.swap.leftover == nil {
+			e.Message(filename, ": new file")
+		}
+		return err
+	}
+	buffer, err := e.bufferize(filename)
 	if err != nil {
 		return err
 	}
-	view, err := e.ViewWithBuffer(buffer, "normal", 0, 0, w, h)
+	mode := "normal"
+	_, hex := e.modes["hex"]
+	binary := buffer.(*document).format.binary && hex
+	if binary {
+		mode = "hex"
+	}
+	view, err := e.ViewWithBuffer(buffer, mode, 0, 0, w, h)
 	if err != nil {
 		return err
 	}
+	view.buffer.hex = binary
 	e.Log("Adding view at", &view)
 	e.addView(&view)
+	if warning := view.buffer.back.checkSwap(); warning != "" {
+		e.Message(warning)
+	}
+	e.watch(view.buffer.back)
 
 	return nil
 }
@@ -102,6 +223,70 @@ func (e *Editor) NewEmptyFile() error {
 	return nil
 }
 
+// NewFile creates a view with an empty buffer that will be saved to the
+// named file, and makes it current. The file isn't created until then, and
+// mustn't already exist.
+func (e *Editor) NewFile(name string) error {
+	if _, err := os.Stat(name); err == nil {
+		return fmt.Errorf("%s already exists", name)
+	}
+	v, err := e.newFileView(name)
+	if err != nil {
+		return err
+	}
+	e.focus(v)
+	return nil
+}
+
+// newFileView adds a view of an empty buffer bound to the named file, and
+// warns about any swap file left for it
+func (e *Editor) newFileView(name string) (*View, error) {
+	b, err := NewBuffer(e.options.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Load(strings.NewReader(""), name); err != nil {
+		return nil, err
+	}
+	d := newDocument(b)
+	d.path = name
+	w, h := termbox.Size()
+	view, err := e.ViewWithBuffer(d, "normal", 0, 0, w, h)
+	if err != nil {
+		return nil, err
+	}
+	e.addView(&view)
+	// a swap file here is from a session that never saved the file
+	if warning := d.checkSwap(); warning != "" {
+		e.Message(warning)
+	}
+	e.watch(d)
+	return &view, nil
+}
+
+// showText opens a new view of a buffer holding text and makes it current
+func (e *Editor) showText(text []byte) (*View, error) {
+	b := &easybuf.Buffer{}
+	b.Load(bytes.NewReader(text), "")
+	w, h := termbox.Size()
+	v, err := e.ViewWithBuffer(b, "normal", 0, 0, w, h)
+	if err != nil {
+		return nil, err
+	}
+	e.addView(&v)
+	e.focus(&v)
+	return &v, nil
+}
+
+// focus makes v the current view
+func (e *Editor) focus(v *View) {
+	for i, w := range e.views {
+		if w == v {
+			e.currentView = i
+		}
+	}
+}
+
 func (e *Editor) addView(v *View) {
 	e.views = append(e.views, v)
 	if e.currentView == -1 {
@@ -109,6 +294,49 @@ func (e *Editor) addView(v *View) {
 	}
 }
 
+// CloseView closes v, and quits if it is the last view. If v is the only
+// view of a buffer with unsaved changes, it refuses once, like Quit.
+func (e *Editor) CloseView(v *View) error {
+	if len(e.views) == 1 {
+		return e.Quit()
+	}
+	d := v.buffer.back
+	shown := 0
+	for _, w := range e.views {
+		if w.buffer.back == d {
+			shown++
+		}
+	}
+	if shown == 1 && d.modified() && e.closeRefused != e.keypresses-1 {
+		e.closeRefused = e.keypresses
+		name := d.path
+		if name == "" {
+			name = "[no name]"
+		}
+		return fmt.Errorf("Unsaved changes in %s: close again to discard them", name)
+	}
+	if shown == 1 {
+		d.removeSwap()
+	}
+	e.removeView(v)
+	return nil
+}
+
+// removeView takes v out of the editor and stops it following its buffer
+func (e *Editor) removeView(v *View) {
+	for i, w := range e.views {
+		if w != v {
+			continue
+		}
+		e.views = append(e.views[:i], e.views[i+1:]...)
+		if e.currentView > i || e.currentView == len(e.views) {
+			e.currentView--
+		}
+		break
+	}
+	v.buffer.unfollow()
+}
+
 // Log writes to the editor's logfile
 func (e *Editor) Log(things ...interface{}) {
 	if e.log != nil {
@@ -141,13 +369,230 @@ func (e *Editor) buildStandardFuncs() {
 		e.log.Println(m)
 		return nil
 	}
+	e.editorCommands["set"] = func(e *Editor, args ...string) error {
+		if len(args) != 2 {
+			return errors.New("set: expected an option name and a value")
+		}
+		return e.SetOption(args[0], args[1])
+	}
 
-	e.viewCommands["quit"] = func(v *View, count int) error {
-		e.Log("Quitting")
-		e.shouldQuit = true
+	e.editorCommands["set-mark"] = func(e *Editor, args ...string) error {
+		if len(args) != 1 {
+			return errors.New("set-mark: expected a mark name")
+		}
+		e.views[e.currentView].SetMark(args[0])
+		return nil
+	}
+	e.editorCommands["jump-to-mark"] = func(e *Editor, args ...string) error {
+		if len(args) != 1 {
+			return errors.New("jump-to-mark: expected a mark name")
+		}
+		return e.views[e.currentView].JumpToMark(args[0])
+	}
+
+	e.editorCommands["tab-width"] = func(e *Editor, args ...string) error {
+		if len(args) != 1 {
+			return errors.New("tab-width: expected a width")
+		}
+		n, err := parseTabWidth(args[0])
+		if err != nil {
+			return err
+		}
+		e.views[e.currentView].buffer.back.tabWidth = n
+		return nil
+	}
+	e.editorCommands["line-endings"] = func(e *Editor, args ...string) error {
+		if len(args) != 1 {
+			return errors.New("line-endings: expected lf or crlf")
+		}
+		le, err := parseLineEnding(args[0])
+		if err != nil {
+			return err
+		}
+		d := e.views[e.currentView].buffer.back
+		f := d.format
+		f.eol = le
+		return d.setFormat(f)
+	}
+	e.editorCommands["encoding"] = func(e *Editor, args ...string) error {
+		d := e.views[e.currentView].buffer.back
+		if len(args) == 0 {
+			e.Message(d.format.enc, ", ", d.format.eol)
+			return nil
+		}
+		enc, err := parseEncoding(args[0])
+		if err != nil {
+			return err
+		}
+		f := d.format
+		f.enc = enc
+		return d.setFormat(f)
+	}
+	e.editorCommands["earlier"] = func(e *Editor, args ...string) error {
+		n, d, err := timeTravel(args)
+		if err != nil {
+			return fmt.Errorf("earlier: %v", err)
+		}
+		v := e.views[e.currentView]
+		if d != 0 {
+			v.travel(v.target.back.Earlier(d))
+		} else {
+			v.travel(v.target.back.Older(n))
+		}
+		return nil
+	}
+	e.editorCommands["later"] = func(e *Editor, args ...string) error {
+		n, d, err := timeTravel(args)
+		if err != nil {
+			return fmt.Errorf("later: %v", err)
+		}
+		v := e.views[e.currentView]
+		if d != 0 {
+			v.travel(v.target.back.Later(d))
+		} else {
+			v.travel(v.target.back.Newer(n))
+		}
+		return nil
+	}
+
+	e.editorCommands["close"] = func(e *Editor, args ...string) error {
+		return e.CloseView(e.views[e.currentView])
+	}
+	e.editorCommands["new"] = func(e *Editor, args ...string) error {
+		switch len(args) {
+		case 0:
+			if err := e.NewEmptyFile(); err != nil {
+				return err
+			}
+			e.focus(e.views[len(e.views)-1])
+			return nil
+		case 1:
+			return e.NewFile(args[0])
+		}
+		return errors.New("new: expected at most a file name")
+	}
+	e.editorCommands["save-as"] = func(e *Editor, args ...string) error {
+		if len(args) != 1 {
+			return errors.New("save-as: expected a file name")
+		}
+		d := e.views[e.currentView].buffer.back
+		if err := d.SaveAs(args[0]); err != nil {
+			return err
+		}
+		e.watch(d)
+		return nil
+	}
+	e.editorCommands["force-save-as"] = func(e *Editor, args ...string) error {
+		if len(args) != 1 {
+			return errors.New("force-save-as: expected a file name")
+		}
+		d := e.views[e.currentView].buffer.back
+		if err := d.ForceSaveAs(args[0]); err != nil {
+			return err
+		}
+		e.watch(d)
+		return nil
+	}
+
+	e.viewCommands["cursor-at-next-match"] = func(v *View, count int) error {
+		for i := 0; i < count; i++ {
+			if err := v.AddCursorAtNextMatch(); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
+	e.viewCommands["cursors-on-lines"] = func(v *View, count int) error {
+		return v.AddCursorsOnLines()
+	}
+	e.viewCommands["single-cursor"] = func(v *View, count int) error {
+		v.SingleCursor()
+		return nil
+	}
+
+	e.editorCommands["yank"] = func(e *Editor, args ...string) error {
+		name, err := optionalRegister("yank", args)
+		if err != nil {
+			return err
+		}
+		return e.views[e.currentView].Yank(name)
+	}
+	e.editorCommands["delete-selection"] = func(e *Editor, args ...string) error {
+		name, err := optionalRegister("delete-selection", args)
+		if err != nil {
+			return err
+		}
+		return e.views[e.currentView].DeleteSelection(name)
+	}
+	e.editorCommands["put"] = func(e *Editor, args ...string) error {
+		name, err := optionalRegister("put", args)
+		if err != nil {
+			return err
+		}
+		return e.views[e.currentView].Put(name, true, 1)
+	}
+	e.editorCommands["put-before"] = func(e *Editor, args ...string) error {
+		name, err := optionalRegister("put-before", args)
+		if err != nil {
+			return err
+		}
+		return e.views[e.currentView].Put(name, false, 1)
+	}
+
+	e.viewCommands["quit"] = func(v *View, count int) error {
+		return e.Quit()
+	}
 	e.viewCommands["save"] = func(v *View, count int) error {
 		return v.buffer.back.Write("")
 	}
+	e.viewCommands["force-save"] = func(v *View, count int) error {
+		return v.buffer.back.ForceWrite("")
+	}
+	e.viewCommands["get"] = func(v *View, count int) error {
+		return e.reload(v.buffer.back)
+	}
+	e.viewCommands["hex"] = func(v *View, count int) error {
+		if _, ok := e.modes["hex"]; !ok {
+			return fmt.Errorf("No hex mode")
+		}
+		v.ToggleHex()
+		return nil
+	}
+	e.viewCommands["undo"] = func(v *View, count int) error {
+		for i := 0; i < count; i++ {
+			v.Undo()
+		}
+		return nil
+	}
+	e.viewCommands["redo"] = func(v *View, count int) error {
+		for i := 0; i < count; i++ {
+			v.Redo()
+		}
+		return nil
+	}
+	e.viewCommands["older"] = func(v *View, count int) error {
+		v.travel(v.target.back.Older(count))
+		return nil
+	}
+	e.viewCommands["newer"] = func(v *View, count int) error {
+		v.travel(v.target.back.Newer(count))
+		return nil
+	}
+	e.viewCommands["swap-recover"] = func(v *View, count int) error {
+		return v.buffer.back.recoverSwap()
+	}
+	e.viewCommands["swap-discard"] = func(v *View, count int) error {
+		return v.buffer.back.discardSwap()
+	}
+	e.viewCommands["swap-diff"] = func(v *View, count int) error {
+		diff, err := v.buffer.back.diffSwap()
+		if err != nil {
+			return err
+		}
+		_, err = e.showText(diff)
+		return err
+	}
+	e.viewCommands["undo-list"] = func(v *View, count int) error {
+		return e.ShowUndoList(v)
+	}
 }
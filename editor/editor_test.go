@@ -0,0 +1,291 @@
+package editor
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/millere/jk/keys"
+	"github.com/nsf/termbox-go"
+)
+
+// testCache keeps the files tests save history and swap files for out of
+// the real cache, and discards logging. It returns a directory to put them in.
+func testCache(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	LogItAll = log.New(io.Discard, "", 0)
+	return dir
+}
+
+// testEditor returns an editor with normal and insert modes and no views,
+// which doesn't log
+func testEditor() *Editor {
+	LogItAll = log.New(io.Discard, "", 0)
+	e := &Editor{modes: make(map[string]*Mode), options: DefaultOptions(), currentView: -1}
+	e.buildStandardFuncs()
+	normal, insert := Normal(e), Insert()
+	e.modes["normal"], e.modes["insert"] = &normal, &insert
+	return e
+}
+
+func TestModified(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "file.txt")
+	os.WriteFile(name, []byte("one\n"), 0644)
+
+	b, _ := BufferizeFile(name)
+	d := b.(*document)
+	if d.modified() {
+		t.Error("Modified as soon as it was loaded")
+	}
+	d.history.Begin()
+	d.WriteAt([]byte("zero\n"), 0)
+	if !d.modified() {
+		t.Error("Not modified after an edit")
+	}
+	d.Write("")
+	if d.modified() {
+		t.Error("Still modified after saving")
+	}
+	d.WriteAt([]byte("!"), 0)
+	d.history.End()
+	if !d.modified() {
+		t.Error("Not modified after an edit in the same group as the save")
+	}
+	d.Undo()
+	if !d.modified() {
+		t.Error("Not modified after undoing past the save")
+	}
+	d.Redo()
+	d.WriteAt([]byte("?"), 0)
+	d.Undo()
+	if !d.modified() {
+		t.Error("Not modified after undoing to a state not saved")
+	}
+}
+
+func TestQuit(t *testing.T) {
+	e := testEditor()
+	v, _ := e.ViewWithBuffer(getDocument("text"), "normal", 0, 0, 80, 24)
+	e.addView(&v)
+	esc := keys.Keypress{Key: keys.Esc}
+
+	if err := e.Do(esc); err != ErrQuit {
+		t.Fatalf("Quitting with no changes gave %v", err)
+	}
+	v.InsertChar('x')
+	e.shouldQuit = false
+	if err := e.Do(esc); err != nil {
+		t.Fatal("Quit with unsaved changes")
+	}
+	if e.message == "" {
+		t.Error("No message about the unsaved changes")
+	}
+	e.Do(keys.Keypress{Key: 'h'})
+	if err := e.Do(esc); err != nil {
+		t.Fatal("Quit when the refusal wasn't on the last keypress")
+	}
+	if err := e.Do(esc); err != ErrQuit {
+		t.Errorf("Quitting twice gave %v", err)
+	}
+}
+
+func TestNewAndSaveAs(t *testing.T) {
+	dir := testCache(t)
+	e := testEditor()
+	name := filepath.Join(dir, "new.txt")
+	if err := e.NewFile(name); err != nil {
+		t.Fatal(err)
+	}
+	v := e.views[e.currentView]
+	v.InsertChar('x')
+	if err := v.buffer.back.Write(""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "x" {
+		t.Errorf("New file holds %q", got)
+	}
+	if err := e.NewFile(name); err == nil {
+		t.Error("Made a new buffer for a file that exists")
+	}
+
+	other := filepath.Join(dir, "sub", "dir", "other.txt")
+	v.InsertChar('y')
+	if err := e.InterpretInternal([]string{"save-as", other}); err != nil || e.message != "" {
+		t.Fatalf("save-as: %v %s", err, e.message)
+	}
+	if got, _ := os.ReadFile(other); string(got) != "xy" {
+		t.Errorf("Saved as %q", got)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "x" {
+		t.Errorf("The old file was changed to %q", got)
+	}
+	d := v.buffer.back
+	if d.path != other || d.modified() {
+		t.Errorf("After save-as, the buffer is bound to %s, modified: %v", d.path, d.modified())
+	}
+
+	v.InsertChar('z')
+	if err := d.writeSwap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ForceSaveAs(dir); err == nil {
+		t.Error("Saved over a directory")
+	}
+	if sw, _ := readSwap(other); sw == nil {
+		t.Error("A failed save-as removed the swap file")
+	}
+	if err := d.SaveAs(name); err == nil {
+		t.Error("save-as overwrote a file that exists")
+	}
+	if d.path != other {
+		t.Errorf("A refused save-as bound the buffer to %s", d.path)
+	}
+	if err := d.ForceSaveAs(name); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "xyz" {
+		t.Errorf("force-save-as wrote %q", got)
+	}
+	if sw, _ := readSwap(other); sw != nil {
+		t.Error("The swap file of the old file was left behind")
+	}
+}
+
+func TestAddMissingFile(t *testing.T) {
+	dir := testCache(t)
+	e := testEditor()
+	name := filepath.Join(dir, "newdir", "newfile.go")
+	if err := e.AddFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(name)); !os.IsNotExist(err) {
+		t.Fatal("Opening a missing file created its directory")
+	}
+	v := e.views[e.currentView]
+	v.InsertChar('p')
+	e.message = ""
+	if err := e.InterpretInternal([]string{"save"}); err != nil || e.message != "" {
+		t.Fatalf("save: %v %s", err, e.message)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "p" {
+		t.Errorf("Saved %q", got)
+	}
+}
+
+func TestMissingFileSwap(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "newfile.go")
+	e := testEditor()
+	if err := e.AddFile(name); err != nil {
+		t.Fatal(err)
+	}
+	d := e.views[e.currentView].buffer.back
+	d.WriteAt([]byte("unsaved"), 0)
+	if err := d.updateSwap(); err != nil {
+		t.Fatal(err)
+	}
+	// jk dies here, before the file is ever saved
+
+	for _, open := range []func(*Editor) error{
+		func(e *Editor) error { return e.AddFile(name) },
+		func(e *Editor) error { return e.NewFile(name) },
+	} {
+		e := testEditor()
+		if err := open(e); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(e.message, "swap file") {
+			t.Errorf("Reopening a never saved file showed %q", e.message)
+		}
+		d := e.views[e.currentView].buffer.back
+		d.WriteAt([]byte("!"), 0)
+		d.updateSwap()
+		if sw, _ := readSwap(name); string(sw.Text) != "unsaved" {
+			t.Errorf("Leftover swap file was overwritten with %q", sw.Text)
+		}
+		if out, err := d.diffSwap(); err != nil || !bytes.Contains(out, []byte("+unsaved")) {
+			t.Errorf("swap-diff gave %q, %v", out, err)
+		}
+		if err := d.recoverSwap(); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := d.Get(); got != "unsaved" {
+			t.Errorf("Recovered %q", got)
+		}
+	}
+}
+
+func TestCloseView(t *testing.T) {
+	e := testEditor()
+	d := getDocument("one\n")
+	subscribers, marks := len(d.subscribers), len(d.marks)
+	var views []*View
+	for i := 0; i < 2; i++ {
+		v, err := e.ViewWithBuffer(d, "normal", 0, 0, 80, 24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.addView(&v)
+		views = append(views, &v)
+	}
+	views[1].SetPoint()
+	views[1].buffer.addCursor(2)
+	if err := e.CloseView(views[1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.views) != 1 || e.currentView != 0 {
+		t.Errorf("Closing a view left %d views, current %d", len(e.views), e.currentView)
+	}
+	if len(d.subscribers) != subscribers+1 || len(d.marks) != marks+1 {
+		t.Errorf("Closing a view left %d subscribers and %d marks, want %d and %d",
+			len(d.subscribers), len(d.marks), subscribers+1, marks+1)
+	}
+
+	if err := e.ShowUndoList(views[0]); err != nil {
+		t.Fatal(err)
+	}
+	list := e.views[e.currentView]
+	list.SetCursor(1, 0)
+	if err := list.Choose(); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.views) != 1 || e.views[e.currentView] != views[0] {
+		t.Errorf("Choosing from the undo list didn't close it")
+	}
+
+	other, _ := e.ViewWithBuffer(getDocument(""), "normal", 0, 0, 80, 24)
+	e.addView(&other)
+	views[0].InsertChar('x')
+	if err := e.CloseView(views[0]); err == nil {
+		t.Errorf("Closing the only view of a modified buffer didn't refuse")
+	}
+	e.keypresses++
+	if err := e.CloseView(views[0]); err != nil || len(e.views) != 1 {
+		t.Errorf("Closing again gave %v and left %d views", err, len(e.views))
+	}
+	if err := e.CloseView(&other); err != nil || !e.shouldQuit {
+		t.Errorf("Closing the last view didn't quit: %v", err)
+	}
+}
+
+func TestMouseOption(t *testing.T) {
+	e := testEditor()
+	if e.InputMode()&termbox.InputMouse != 0 {
+		t.Errorf("The mouse is on by default")
+	}
+	if err := e.SetOption("mouse", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if e.InputMode()&termbox.InputMouse == 0 {
+		t.Errorf("Setting the mouse option didn't turn the mouse on")
+	}
+	if err := e.SetOption("mouse", "sometimes"); err == nil {
+		t.Errorf("Setting the mouse option to %q didn't fail", "sometimes")
+	}
+}
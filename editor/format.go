@@ -0,0 +1,269 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// A lineEnding is the way lines are terminated in a file. Buffers always
+// hold lines ending in '\n'; other endings are restored when saving.
+type lineEnding int
+
+const (
+	lf lineEnding = iota
+	crlf
+)
+
+func (le lineEnding) String() string {
+	if le == crlf {
+		return "crlf"
+	}
+	return "lf"
+}
+
+func parseLineEnding(s string) (lineEnding, error) {
+	switch s {
+	case "lf", "unix":
+		return lf, nil
+	case "crlf", "dos":
+		return crlf, nil
+	}
+	return lf, fmt.Errorf("Unknown line ending %s", s)
+}
+
+// detectLineEnding returns crlf if every line in b ends in CRLF. Files that
+// mix line endings are taken as LF, leaving the '\r's in the text, so that
+// saving them doesn't change lines nobody edited. Columns treat a '\r'
+// before a '\n' as part of the line ending, so it is never shown.
+func detectLineEnding(b []byte) lineEnding {
+	n := bytes.Count(b, []byte{'\n'})
+	if n > 0 && bytes.Count(b, []byte("\r\n")) == n {
+		return crlf
+	}
+	return lf
+}
+
+// An encoding is the character encoding of a file. Buffers always hold
+// UTF-8; files in other encodings are converted when loading and saving.
+type encoding int
+
+const (
+	utf8Plain encoding = iota
+	utf8BOM
+	utf16LE
+	utf16BE
+	latin1
+)
+
+var encodingNames = map[encoding]string{
+	utf8Plain: "utf-8",
+	utf8BOM:   "utf-8-bom",
+	utf16LE:   "utf-16le",
+	utf16BE:   "utf-16be",
+	latin1:    "latin-1",
+}
+
+func (enc encoding) String() string {
+	return encodingNames[enc]
+}
+
+func parseEncoding(s string) (encoding, error) {
+	s = strings.ToLower(s)
+	switch s {
+	case "utf8":
+		return utf8Plain, nil
+	case "iso-8859-1", "latin1":
+		return latin1, nil
+	}
+	for enc, name := range encodingNames {
+		if s == name {
+			return enc, nil
+		}
+	}
+	return utf8Plain, fmt.Errorf("Unknown encoding %s", s)
+}
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// detectEncoding guesses the encoding of raw from its byte order mark,
+// falling back to Latin-1 for anything that isn't mostly UTF-8
+func detectEncoding(raw []byte) encoding {
+	switch {
+	case bytes.HasPrefix(raw, bomUTF8):
+		return utf8BOM
+	case bytes.HasPrefix(raw, bomUTF16LE):
+		return utf16LE
+	case bytes.HasPrefix(raw, bomUTF16BE):
+		return utf16BE
+	case mostlyUTF8(raw):
+		return utf8Plain
+	}
+	return latin1
+}
+
+// mostlyUTF8 reports whether raw reads as UTF-8 with at most a few stray
+// bytes, which are kept as they are. Text with more invalid bytes than
+// multibyte characters is more likely Latin-1.
+func mostlyUTF8(raw []byte) bool {
+	valid, invalid := 0, 0
+	for i := 0; i < len(raw); {
+		if raw[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, n := utf8.DecodeRune(raw[i:])
+		if r == utf8.RuneError && n == 1 {
+			invalid++
+		} else {
+			valid++
+		}
+		i += n
+	}
+	return invalid <= valid
+}
+
+// toUTF8 decodes raw from enc into UTF-8, dropping any byte order mark
+func (enc encoding) toUTF8(raw []byte) []byte {
+	switch enc {
+	case utf8BOM:
+		return raw[len(bomUTF8):]
+	case utf16LE, utf16BE:
+		runes := utf16.Decode(enc.units(raw))
+		if len(raw)%2 == 1 {
+			runes = append(runes, utf8.RuneError)
+		}
+		return []byte(string(runes))
+	case latin1:
+		b := make([]byte, 0, len(raw))
+		for _, c := range raw {
+			b = utf8.AppendRune(b, rune(c))
+		}
+		return b
+	}
+	return raw
+}
+
+// units returns the UTF-16 units of raw after its byte order mark,
+// dropping any odd byte at the end
+func (enc encoding) units(raw []byte) []uint16 {
+	raw = raw[2:]
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		if enc == utf16LE {
+			units[i] = uint16(raw[2*i]) | uint16(raw[2*i+1])<<8
+		} else {
+			units[i] = uint16(raw[2*i])<<8 | uint16(raw[2*i+1])
+		}
+	}
+	return units
+}
+
+// validUTF16 reports whether raw is whole UTF-16 units with every surrogate
+// in a pair, as text is and other data that starts like a byte order mark
+// seldom is
+func (enc encoding) validUTF16(raw []byte) bool {
+	if len(raw)%2 == 1 {
+		return false
+	}
+	units := enc.units(raw)
+	for i := 0; i < len(units); i++ {
+		switch u := units[i]; {
+		case u >= 0xd800 && u < 0xdc00:
+			if i+1 == len(units) || units[i+1] < 0xdc00 || units[i+1] > 0xdfff {
+				return false
+			}
+			i++
+		case u >= 0xdc00 && u <= 0xdfff:
+			return false
+		}
+	}
+	return true
+}
+
+// fromUTF8 encodes UTF-8 text in enc, with a byte order mark if enc has one
+func (enc encoding) fromUTF8(text []byte) ([]byte, error) {
+	switch enc {
+	case utf8BOM:
+		return append(append([]byte(nil), bomUTF8...), text...), nil
+	case utf16LE, utf16BE:
+		units := utf16.Encode([]rune(string(text)))
+		b := make([]byte, 2, 2+2*len(units))
+		copy(b, bomUTF16LE)
+		if enc == utf16BE {
+			copy(b, bomUTF16BE)
+		}
+		for _, u := range units {
+			if enc == utf16LE {
+				b = append(b, byte(u), byte(u>>8))
+			} else {
+				b = append(b, byte(u>>8), byte(u))
+			}
+		}
+		return b, nil
+	case latin1:
+		b := make([]byte, 0, len(text))
+		line := 0
+		for _, r := range string(text) {
+			if r > 0xff {
+				return nil, fmt.Errorf("Can't encode %q on line %d in %v", r, line+1, enc)
+			}
+			if r == '\n' {
+				line++
+			}
+			b = append(b, byte(r))
+		}
+		return b, nil
+	}
+	return text, nil
+}
+
+// A fileFormat describes how the text of a buffer is stored in its file
+type fileFormat struct {
+	eol    lineEnding
+	enc    encoding
+	binary bool // binary files are held byte for byte, as UTF-8 with LF
+}
+
+// detectFormat works out the format of raw, the contents of a file. Byte
+// order marks are only trusted if what follows them is text, so that binary
+// files that happen to start with one are still held byte for byte.
+func detectFormat(raw []byte) fileFormat {
+	enc := detectEncoding(raw)
+	binary := isBinary(raw)
+	if enc == utf16LE || enc == utf16BE {
+		// UTF-16 text is full of zero bytes, so check what it decodes to
+		binary = !enc.validUTF16(raw) || isBinary(enc.toUTF8(raw))
+	}
+	if binary {
+		return fileFormat{binary: true}
+	}
+	return fileFormat{eol: detectLineEnding(enc.toUTF8(raw)), enc: enc}
+}
+
+// decode turns the contents of a file in format f into buffer text
+func (f fileFormat) decode(raw []byte) []byte {
+	text := f.enc.toUTF8(raw)
+	if f.eol == crlf {
+		text = bytes.Replace(text, []byte("\r\n"), []byte{'\n'}, -1)
+	}
+	return text
+}
+
+// encode turns buffer text into the contents of a file in format f
+func (f fileFormat) encode(text []byte) ([]byte, error) {
+	if f.eol == crlf {
+		text = bytes.Replace(text, []byte{'\n'}, []byte("\r\n"), -1)
+	}
+	return f.enc.fromUTF8(text)
+}
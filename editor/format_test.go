@@ -0,0 +1,128 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLineEndings(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "dos.txt")
+	os.WriteFile(name, []byte("one\r\ntwo\r\n"), 0644)
+
+	b, err := BufferizeFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.GetLine(0); got != "one\n" {
+		t.Errorf("Got line %q, expected %q", got, "one\n")
+	}
+	b.WriteAt([]byte("three\n"), b.OffsetOf(2, 0))
+	if err := b.Write(""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "one\r\ntwo\r\nthree\r\n" {
+		t.Errorf("Saved %q", got)
+	}
+
+	b.(*document).format.eol = lf
+	b.Write("")
+	if got, _ := os.ReadFile(name); string(got) != "one\ntwo\nthree\n" {
+		t.Errorf("Saved %q after converting", got)
+	}
+
+	mixed := filepath.Join(dir, "mixed.txt")
+	os.WriteFile(mixed, []byte("one\r\ntwo\r\nthree\n"), 0644)
+	b, err = BufferizeFile(mixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.WriteAt([]byte("zero\r\n"), 0)
+	b.Write("")
+	if got, _ := os.ReadFile(mixed); string(got) != "zero\r\none\r\ntwo\r\nthree\n" {
+		t.Errorf("Saved %q for a file with mixed line endings", got)
+	}
+}
+
+func TestMixedLineEndingsInColumns(t *testing.T) {
+	v := cursorView(t, "one\r\ntwo\n")
+	v.SetCursor(0, 10)
+	if v.buffer.C != (Cursor{0, 3}) {
+		t.Errorf("The end of a CRLF line is at %v, want {0 3}", v.buffer.C)
+	}
+	v.InsertChar('!')
+	if got := contents(v.buffer.back); got != "one!\r\ntwo\n" {
+		t.Errorf("Typing at the end of a CRLF line gave %q", got)
+	}
+	v.SetCursor(1, 0)
+	v.DeleteBackwards()
+	if got := contents(v.buffer.back); got != "one!two\n" {
+		t.Errorf("Joining a CRLF line with the next gave %q", got)
+	}
+}
+
+func TestDetectLineEnding(t *testing.T) {
+	cases := []struct {
+		text   string
+		expect lineEnding
+	}{
+		{"", lf},
+		{"no newline\r", lf},
+		{"a\nb\n", lf},
+		{"a\r\nb\r\n", crlf},
+		{"a\r\nb\r\nc\n", lf},
+		{"a\r\nb\r\nc\r\nd", crlf},
+		{"a\r\nb\nc\n", lf},
+	}
+	for i, c := range cases {
+		if got := detectLineEnding([]byte(c.text)); got != c.expect {
+			t.Errorf("Case %d: got %v, expected %v", i, got, c.expect)
+		}
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	cases := []struct {
+		raw    []byte
+		enc    encoding
+		expect string
+	}{
+		{[]byte("plain\n"), utf8Plain, "plain\n"},
+		{[]byte("\xef\xbb\xbfbom\n"), utf8BOM, "bom\n"},
+		{[]byte("caf\xe9\n"), latin1, "café\n"},
+		{[]byte("café \xff\n"), utf8Plain, "café \xff\n"},
+		{[]byte("\xff\xfeh\x00i\x00\r\x00\n\x00"), utf16LE, "hi\n"},
+		{[]byte("\xfe\xff\x00h\x00i\xd8\x3d\xde\x00"), utf16BE, "hi😀"},
+	}
+	for i, c := range cases {
+		f := detectFormat(c.raw)
+		if f.enc != c.enc {
+			t.Errorf("Case %d: detected %v, expected %v", i, f.enc, c.enc)
+			continue
+		}
+		text := f.decode(c.raw)
+		if string(text) != c.expect {
+			t.Errorf("Case %d: decoded %q, expected %q", i, text, c.expect)
+		}
+		raw, err := f.encode(text)
+		if err != nil || string(raw) != string(c.raw) {
+			t.Errorf("Case %d: encoded %q, %v, expected %q", i, raw, err, c.raw)
+		}
+	}
+
+	for _, raw := range []string{
+		"\xef\xbb\xbf\x00\x01\x02\x03",
+		"\xff\xfe\x00\x00\x01\x00\x02\x00",
+		"\xfe\xff\xdc\x00\x00h",
+		"\xff\xfeh\x00i",
+	} {
+		if f := detectFormat([]byte(raw)); !f.binary {
+			t.Errorf("Binary data %q was taken as %v text", raw, f.enc)
+		}
+	}
+
+	if _, err := latin1.fromUTF8([]byte("ok\n日本")); err == nil {
+		t.Errorf("Encoded characters Latin-1 doesn't have")
+	}
+}
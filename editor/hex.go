@@ -0,0 +1,301 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+
+	"github.com/millere/jk/keys"
+	"github.com/nsf/termbox-go"
+)
+
+// HexRowBytes is the number of bytes shown on each row of a hex view
+const HexRowBytes = 16
+
+// binarySample is how much of a file is looked at to decide if it's binary
+const binarySample = 8000
+
+// isBinary guesses whether raw, the start of a file, is binary rather than
+// text: it is if it has NUL bytes, or many control characters that don't
+// turn up in text
+func isBinary(raw []byte) bool {
+	if len(raw) > binarySample {
+		raw = raw[:binarySample]
+	}
+	control := 0
+	for _, c := range raw {
+		switch {
+		case c == 0:
+			return true
+		case c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\b' || c == 0x1b:
+		case c < 0x20 || c == 0x7f:
+			control++
+		}
+	}
+	return control*10 > len(raw)
+}
+
+// Columns of a hex row: the offset, then the bytes in two groups of eight,
+// then the ASCII gutter
+const (
+	hexBytesX = 10
+	hexASCIIX = hexBytesX + 3*HexRowBytes + 2
+)
+
+// hexX returns the column the ith byte of a row is drawn at in hex
+func hexX(i int) int {
+	x := hexBytesX + 3*i
+	if i >= HexRowBytes/2 {
+		x++
+	}
+	return x
+}
+
+// drawHex draws the buffer as rows of offsets, hex bytes and ASCII
+func (v *View) drawHex() {
+	s := v.buffer
+	s.area.Clear()
+	start, end, selecting := s.region()
+	size := int64(s.back.Len())
+
+	_, h := s.area.Size()
+	for l := 0; l < h; l++ {
+		rowOff := int64(l+s.firstLine) * HexRowBytes
+		if rowOff >= size && !(rowOff == 0 && size == 0) {
+			break
+		}
+		last := rowOff + HexRowBytes - 1
+		if last >= size {
+			last = size - 1
+		}
+		row, _ := s.back.FromTo(rowOff, last)
+		s.area.WriteLine(fmt.Sprintf("%08x", rowOff), 0, l, hexBytesX, termbox.ColorYellow, termbox.ColorDefault)
+		for i := 0; i < len(row); i++ {
+			bg := termbox.ColorDefault
+			if off := rowOff + int64(i); selecting && start <= off && off <= end {
+				bg = termbox.ColorRed
+			}
+			digits := fmt.Sprintf("%02x", row[i])
+			s.area.SetCell(hexX(i), l, rune(digits[0]), termbox.ColorDefault, bg)
+			s.area.SetCell(hexX(i)+1, l, rune(digits[1]), termbox.ColorDefault, bg)
+			c := rune(row[i])
+			if c < 0x20 || c >= 0x7f {
+				c = '.'
+			}
+			s.area.SetCell(hexASCIIX+i, l, c, termbox.ColorDefault, bg)
+		}
+	}
+	if v.buffer == v.target {
+		x := hexX(s.C.Column) + s.nibble
+		if s.ascii {
+			x = hexASCIIX + s.C.Column
+		}
+		s.area.SetCursor(x, s.C.Line-s.firstLine)
+	}
+}
+
+// setHexOffset puts the cursor on the byte at off. The byte just past the
+// end can be reached, so that bytes can be added.
+func (v *View) setHexOffset(off int64) {
+	if max := int64(v.target.back.Len()); off > max {
+		off = max
+	}
+	if off < 0 {
+		off = 0
+	}
+	v.target.C = v.target.cursorAt(off)
+	v.target.nibble = 0
+	v.scrollToCursor()
+}
+
+// MoveBytes moves the cursor n bytes forwards, or backwards if n is negative
+func (v *View) MoveBytes(n int) {
+	s, max := v.target, int64(v.target.back.Len())
+	for _, x := range s.extra {
+		x.at.off += int64(n)
+		if x.at.off > max {
+			x.at.off = max
+		}
+		if x.at.off < 0 {
+			x.at.off = 0
+		}
+	}
+	v.setHexOffset(v.target.offsetOf(v.target.C) + int64(n))
+	s.merge()
+}
+
+// OverwriteByte replaces the byte under the cursor with c, or adds c if the
+// cursor is past the end
+func (v *View) OverwriteByte(c byte) {
+	s := v.target
+	off := s.offsetOf(s.C)
+	if off == int64(s.back.Len()) {
+		// the cursor stays on the added byte rather than following the end
+		s.back.WriteAt([]byte{c}, off)
+		s.C = s.cursorAt(off)
+		s.scroll()
+		return
+	}
+	// inserting after the old byte keeps marks on it where they are
+	s.back.history.Begin()
+	s.back.WriteAt([]byte{c}, off+1)
+	s.back.Delete(1, off)
+	s.back.history.End()
+}
+
+// OverwriteNibble sets the half of the byte under the cursor that is being
+// edited to the hex digit d, moving on to the next half
+func (v *View) OverwriteNibble(d byte) {
+	s := v.target
+	off := s.offsetOf(s.C)
+	var c byte
+	if off < int64(s.back.Len()) {
+		old, _ := s.back.FromTo(off, off)
+		c = old[0]
+	}
+	if s.nibble == 0 {
+		c = d<<4 | c&0x0f
+	} else {
+		c = c&0xf0 | d
+	}
+	v.OverwriteByte(c)
+	if s.nibble == 0 {
+		s.nibble = 1
+	} else {
+		v.MoveBytes(1)
+	}
+}
+
+// ToggleHex switches the view between showing its buffer as text and as
+// hex, keeping the cursor on the same byte
+func (v *View) ToggleHex() {
+	s := v.buffer
+	off := s.offsetOf(s.C)
+	s.hex = !s.hex
+	s.nibble = 0
+	s.ascii = false
+	s.firstLine = 0
+	c := s.cursorAt(off)
+	v.target = s
+	v.SetCursor(c.Line, c.Column)
+	if s.hex {
+		v.SetMode((*v.modes)["hex"], "hex")
+	} else {
+		v.SetMode((*v.modes)["normal"], "normal")
+	}
+}
+
+// hexDigit returns the value of the hex digit r, or -1
+func hexDigit(r rune) int {
+	switch {
+	case '0' <= r && r <= '9':
+		return int(r - '0')
+	case 'a' <= r && r <= 'f':
+		return int(r-'a') + 10
+	case 'A' <= r && r <= 'F':
+		return int(r-'A') + 10
+	}
+	return -1
+}
+
+// hexMotions binds the arrow keys to moving around a hex view
+func hexMotions(m map[keys.Keypress]ModeFunc) {
+	moves := map[keys.Key]int{
+		keys.Left:  -1,
+		keys.Right: 1,
+		keys.Up:    -HexRowBytes,
+		keys.Down:  HexRowBytes,
+	}
+	for k, n := range moves {
+		n := n
+		m[keys.Keypress{Key: k}] = func(v *View, count int) error {
+			v.MoveBytes(n * count)
+			return nil
+		}
+	}
+}
+
+// Hex builds hex mode, for moving around binary files
+func Hex(e *Editor) Mode {
+	m := make(map[keys.Keypress]ModeFunc)
+	sharedBindings(e, m)
+	hexMotions(m)
+	moves := map[rune]int{'h': -1, 'i': 1, 'e': -HexRowBytes, 'n': HexRowBytes}
+	for k, n := range moves {
+		n := n
+		m[keys.Keypress{Key: keys.Key(k)}] = func(v *View, count int) error {
+			v.MoveBytes(n * count)
+			return nil
+		}
+	}
+	m[keys.Keypress{Key: 't'}] = func(v *View, count int) error {
+		v.SetMode((*v.modes)["hex-overwrite"], "hex-overwrite")
+		return nil
+	}
+	m[keys.Keypress{Key: 'x'}] = e.viewCommands["hex"]
+
+	return Mode{EventMap: m}
+}
+
+// HexOverwrite builds the mode for overwriting bytes in a hex view. Hex
+// digits are typed over the bytes, or with Tab, characters over the ASCII
+// gutter.
+func HexOverwrite() Mode {
+	m := make(map[keys.Keypress]ModeFunc)
+	hexMotions(m)
+	m[keys.Keypress{Key: keys.Esc}] = func(v *View, count int) error {
+		v.target.nibble = 0
+		v.SetMode((*v.modes)["hex"], "hex")
+		return nil
+	}
+	m[keys.Keypress{Key: keys.Tab}] = func(v *View, count int) error {
+		v.target.ascii = !v.target.ascii
+		v.target.nibble = 0
+		return nil
+	}
+	m[keys.Keypress{Key: keys.Backspace}] = func(v *View, count int) error {
+		v.MoveBytes(-count)
+		return nil
+	}
+
+	overwrite := func(v *View, k keys.Keypress, count int) error {
+		r := rune(k.Key)
+		if k.Mod != 0 {
+			LogItAll.Printf("No function bound to key %v", k)
+			return nil
+		}
+		if v.target.ascii {
+			if r < 0x20 || r >= 0x7f {
+				return fmt.Errorf("Only ASCII can be typed in the gutter")
+			}
+			for i := 0; i < count; i++ {
+				v.OverwriteByte(byte(r))
+				v.MoveBytes(1)
+			}
+			return nil
+		}
+		d := hexDigit(r)
+		if d == -1 {
+			return fmt.Errorf("%q isn't a hex digit", r)
+		}
+		for i := 0; i < count; i++ {
+			v.OverwriteNibble(byte(d))
+		}
+		return nil
+	}
+	return Mode{
+		// Everything typed in one visit is undone together
+		OnEnter: func(v *View) error {
+			v.target.back.history.Begin()
+			return nil
+		},
+		OnExit: func(v *View) error {
+			v.target.back.history.End()
+			return nil
+		},
+		EventMap: m,
+		Default:  overwrite,
+	}
+}
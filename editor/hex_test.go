@@ -0,0 +1,77 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/millere/jk/keys"
+)
+
+func TestIsBinary(t *testing.T) {
+	cases := []struct {
+		raw    string
+		binary bool
+	}{
+		{"plain text\n", false},
+		{"tabs\tand\r\nescapes \x1b[1m\n", false},
+		{"caf\xe9\n", false},
+		{"\x7fELF\x02\x01\x01\x00", true},
+		{"\x01\x02\x03\x04text", true},
+	}
+	for _, c := range cases {
+		if got := isBinary([]byte(c.raw)); got != c.binary {
+			t.Errorf("isBinary(%q) = %v", c.raw, got)
+		}
+	}
+}
+
+func TestHexEditing(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "blob.bin")
+	raw := []byte("\x00\x01\x02\x03\r\n\xff\xfe\x0a\x0d\x00\x00\x00\x00\x00\x00\x10\x11")
+	os.WriteFile(name, raw, 0644)
+
+	e := testEditor()
+	hex, overwrite := Hex(e), HexOverwrite()
+	e.modes["hex"], e.modes["hex-overwrite"] = &hex, &overwrite
+	b, err := BufferizeFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.(*document).format.binary {
+		t.Fatal("Binary file wasn't detected")
+	}
+	v, _ := e.ViewWithBuffer(b, "hex", 0, 0, 80, 24)
+	v.buffer.hex = true
+
+	press := func(ks ...keys.Key) {
+		for _, k := range ks {
+			if err := v.Do(keys.Keypress{Key: k}); err != nil {
+				t.Errorf("Pressing %v: %v", k, err)
+			}
+		}
+	}
+	// the last byte is typed over, then one is added and typed over again
+	press('n', 'i', 't', 'a', 'b', 'c', keys.Tab, 'Z', keys.Esc)
+	if v.buffer.C != (Cursor{1, 3}) {
+		t.Errorf("Cursor ended up at %v", v.buffer.C)
+	}
+
+	got, _ := b.Get()
+	want := append(append([]byte(nil), raw[:17]...), 0xab, 'Z')
+	if got != string(want) {
+		t.Errorf("Got %q, expected %q", got, want)
+	}
+
+	if err := b.Write(""); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := os.ReadFile(name); string(saved) != string(want) {
+		t.Errorf("Saved %q, expected %q", saved, want)
+	}
+	v.Undo()
+	if got, _ := b.Get(); got != string(raw) {
+		t.Errorf("Undoing gave %q", got)
+	}
+}
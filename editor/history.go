@@ -0,0 +1,229 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"sort"
+	"time"
+)
+
+// An edit is a single change to a buffer: deleted was removed from off,
+// then inserted was written there
+type edit struct {
+	off      int64
+	deleted  []byte
+	inserted []byte
+}
+
+// A step is the list of edits undone or redone by one command
+type step []edit
+
+// A state is a version of a buffer's text. States form a tree: undoing
+// and then making a new change starts a new branch rather than throwing
+// the undone changes away.
+type state struct {
+	seq      int       // states are numbered in the order they were made
+	parent   *state    // the state this one was made from
+	children []*state  // the states made from this one, oldest first
+	next     *state    // the child redo moves to
+	step     step      // the edits that turn parent into this state
+	time     time.Time // when this state was last changed
+	depth    int       // how many steps this state is from the root
+}
+
+// A history records the edits made to a buffer so they can be undone
+type history struct {
+	root   *state   // the text as it was loaded
+	cur    *state   // the state the buffer is in
+	states []*state // every state, by seq
+	depth  int      // how many groups are open
+	open   bool     // whether cur is still being added to
+}
+
+func newHistory() history {
+	root := &state{time: time.Now()}
+	return history{
+		root:   root,
+		cur:    root,
+		states: []*state{root},
+	}
+}
+
+// Begin starts a group: everything recorded until the matching End is
+// undone as a single step
+func (h *history) Begin() {
+	if h.depth == 0 {
+		h.open = false
+	}
+	h.depth++
+}
+
+// End closes the group opened by the matching Begin
+func (h *history) End() {
+	if h.depth > 0 {
+		h.depth--
+	}
+	if h.depth == 0 {
+		h.open = false
+	}
+}
+
+// record adds an edit to the history as a new state branching from the
+// current one
+func (h *history) record(e edit) {
+	if h.open {
+		h.cur.step = append(h.cur.step, e)
+		h.cur.time = time.Now()
+		return
+	}
+	s := &state{
+		seq:    len(h.states),
+		parent: h.cur,
+		step:   step{e},
+		time:   time.Now(),
+		depth:  h.cur.depth + 1,
+	}
+	h.cur.children = append(h.cur.children, s)
+	h.cur.next = s
+	h.states = append(h.states, s)
+	h.cur = s
+	h.open = h.depth > 0
+}
+
+// undo reverts the current step in b, returning the offset of the
+// first edit in it, or -1 if there is nothing to undo
+func (h *history) undo(b WriteBuffer) int64 {
+	s := h.cur
+	if s.parent == nil {
+		return -1
+	}
+	h.open = false
+	s.step.revert(b)
+	s.parent.next = s
+	h.cur = s.parent
+	return s.step[0].off
+}
+
+// redo reapplies the most recently undone step in b, returning the offset
+// of the last edit in it, or -1 if there is nothing to redo
+func (h *history) redo(b WriteBuffer) int64 {
+	s := h.cur.next
+	if s == nil {
+		return -1
+	}
+	h.open = false
+	s.step.apply(b)
+	h.cur = s
+	e := s.step[len(s.step)-1]
+	return e.off + int64(len(e.inserted))
+}
+
+// jump moves b to the state numbered seq, undoing back to where the
+// current state and the target branch meet and redoing down to the
+// target. It returns the offset of the last edit made, or -1 if nothing
+// changed.
+func (h *history) jump(b WriteBuffer, seq int) int64 {
+	if seq < 0 || seq >= len(h.states) || seq == h.cur.seq {
+		return -1
+	}
+	target := h.states[seq]
+	var path []*state
+	for t := target; t != nil; t = t.parent {
+		path = append(path, t)
+	}
+	onPath := func(s *state) bool {
+		return s.depth < len(path) && path[len(path)-1-s.depth] == s
+	}
+
+	off := int64(-1)
+	for !onPath(h.cur) {
+		off = h.undo(b)
+	}
+	for i := len(path) - 1 - h.cur.depth - 1; i >= 0; i-- {
+		h.cur.next = path[i]
+		off = h.redo(b)
+	}
+	return off
+}
+
+// older moves b n states back in the order states were made
+func (h *history) older(b WriteBuffer, n int) int64 {
+	seq := h.cur.seq - n
+	if seq < 0 {
+		seq = 0
+	}
+	return h.jump(b, seq)
+}
+
+// newer moves b n states forward in the order states were made
+func (h *history) newer(b WriteBuffer, n int) int64 {
+	seq := h.cur.seq + n
+	if seq >= len(h.states) {
+		seq = len(h.states) - 1
+	}
+	return h.jump(b, seq)
+}
+
+// at returns the seq of the newest state made at or before t
+func (h *history) at(t time.Time) int {
+	i := sort.Search(len(h.states), func(i int) bool {
+		return h.states[i].time.After(t)
+	})
+	if i == 0 {
+		return 0
+	}
+	return i - 1
+}
+
+// earlier moves b to the state it was in d before the current state
+func (h *history) earlier(b WriteBuffer, d time.Duration) int64 {
+	return h.jump(b, h.at(h.cur.time.Add(-d)))
+}
+
+// later moves b to the state it was in d after the current state
+func (h *history) later(b WriteBuffer, d time.Duration) int64 {
+	seq := h.at(h.cur.time.Add(d))
+	if seq < h.cur.seq {
+		return -1
+	}
+	return h.jump(b, seq)
+}
+
+// branches returns the tips of every branch of the history, along with
+// the current state, oldest first
+func (h *history) branches() []*state {
+	var tips []*state
+	for _, s := range h.states {
+		if len(s.children) == 0 || s == h.cur {
+			tips = append(tips, s)
+		}
+	}
+	return tips
+}
+
+// apply makes the edits of s to b, in order
+func (s step) apply(b WriteBuffer) {
+	for _, e := range s {
+		if len(e.deleted) > 0 {
+			b.Delete(int64(len(e.deleted)), e.off)
+		}
+		if len(e.inserted) > 0 {
+			b.WriteAt(e.inserted, e.off)
+		}
+	}
+}
+
+// revert undoes the edits of s to b, in reverse order
+func (s step) revert(b WriteBuffer) {
+	for i := len(s) - 1; i >= 0; i-- {
+		e := s[i]
+		if len(e.inserted) > 0 {
+			b.Delete(int64(len(e.inserted)), e.off)
+		}
+		if len(e.deleted) > 0 {
+			b.WriteAt(e.deleted, e.off)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package editor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/millere/jk/easybuf"
+)
+
+func getDocument(s string) *document {
+	b := new(easybuf.Buffer)
+	b.WriteAt([]byte(s), 0)
+	return newDocument(b)
+}
+
+func contents(d *document) string {
+	if d.Len() == 0 {
+		return ""
+	}
+	s, _ := d.FromTo(0, int64(d.Len()-1))
+	return s
+}
+
+func TestUndoRedo(t *testing.T) {
+	d := getDocument("hello world")
+	d.WriteAt([]byte(","), 5)
+	d.Delete(6, 6)
+	d.history.Begin()
+	d.WriteAt([]byte(" there"), 6)
+	d.WriteAt([]byte("!"), 12)
+	d.history.End()
+
+	states := []string{
+		"hello, there!",
+		"hello,",
+		"hello, world",
+		"hello world",
+	}
+	for i, expect := range states[1:] {
+		if got := contents(d); got != states[i] {
+			t.Errorf("Undo %d: got %q, expected %q", i, got, states[i])
+		}
+		d.Undo()
+		if got := contents(d); got != expect {
+			t.Errorf("Undo %d: got %q, expected %q", i+1, got, expect)
+		}
+	}
+	if off := d.Undo(); off != -1 {
+		t.Errorf("Undo with empty history changed offset %d", off)
+	}
+
+	d.Redo()
+	d.Redo()
+	if got := contents(d); got != "hello," {
+		t.Errorf("Redo: got %q", got)
+	}
+	d.WriteAt([]byte("?"), 0)
+	if off := d.Redo(); off != -1 {
+		t.Errorf("Redo after a new edit changed offset %d", off)
+	}
+}
+
+func TestCursorAt(t *testing.T) {
+	d := getDocument("one\ntwo\nthree")
+	cases := []struct {
+		off    int64
+		expect Cursor
+	}{
+		{0, Cursor{0, 0}},
+		{3, Cursor{0, 3}},
+		{4, Cursor{1, 0}},
+		{10, Cursor{2, 2}},
+	}
+	for i, c := range cases {
+		if got := cursorAt(d, c.off); got != c.expect {
+			t.Errorf("Case %d: got %v, expected %v", i, got, c.expect)
+		}
+	}
+}
+
+func TestBranches(t *testing.T) {
+	d := getDocument("a")
+	d.WriteAt([]byte("b"), 1) // 1: ab
+	d.WriteAt([]byte("c"), 2) // 2: abc
+	d.Undo()
+	d.WriteAt([]byte("d"), 2) // 3: abd, a branch from 1
+
+	if got := len(d.history.branches()); got != 2 {
+		t.Errorf("Got %d branches, expected 2", got)
+	}
+
+	expect := []string{"abc", "ab", "a"}
+	for i, e := range expect {
+		d.Older(1)
+		if got := contents(d); got != e {
+			t.Errorf("Older %d: got %q, expected %q", i+1, got, e)
+		}
+	}
+	d.Newer(2)
+	if got := contents(d); got != "abc" {
+		t.Errorf("Newer: got %q, expected %q", got, "abc")
+	}
+	d.Jump(3)
+	if got := contents(d); got != "abd" {
+		t.Errorf("Jump: got %q, expected %q", got, "abd")
+	}
+	d.Redo()
+	d.Undo()
+	d.Redo()
+	if got := contents(d); got != "abd" {
+		t.Errorf("Redo after a jump: got %q, expected %q", got, "abd")
+	}
+}
+
+func TestEarlier(t *testing.T) {
+	d := getDocument("")
+	d.WriteAt([]byte("a"), 0)
+	d.WriteAt([]byte("b"), 1)
+	base := d.history.root.time
+	for i, s := range d.history.states {
+		s.time = base.Add(time.Duration(i) * time.Minute)
+	}
+
+	d.Earlier(90 * time.Second)
+	if got := contents(d); got != "" {
+		t.Errorf("Earlier: got %q, expected nothing", got)
+	}
+	d.Later(time.Minute)
+	if got := contents(d); got != "a" {
+		t.Errorf("Later: got %q, expected %q", got, "a")
+	}
+}
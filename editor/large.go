@@ -0,0 +1,167 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/millere/jk/atomicfile"
+	"github.com/millere/jk/mmapbuf"
+)
+
+// DefaultLargeFileSize is the size from which files are opened in large-file
+// mode, unless the large-file-size option says otherwise
+const DefaultLargeFileSize = 64 << 20
+
+// formatSample is how much of a large file its format is detected from
+const formatSample = 64 << 10
+
+// bufferize loads the named file into a buffer of the editor's backend, or
+// maps it if it's large enough
+func (e *Editor) bufferize(fname string) (WriteBuffer, error) {
+	if fi, err := os.Stat(fname); err == nil && fi.Size() >= e.options.LargeFileSize {
+		return bufferizeLarge(fname, e.options.Backend)
+	}
+	return BufferizeFileWith(fname, e.options.Backend)
+}
+
+// bufferizeLarge returns a Buffer that maps the named file rather than
+// copying it into memory. Only UTF-8 files with Unix line endings can be
+// mapped, along with binary files, as others have to be converted; they're
+// loaded into the named backend as usual.
+// Large documents have no swap file or saved history, which would mean
+// copying them after all.
+func bufferizeLarge(fname, backend string) (WriteBuffer, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	sample := make([]byte, formatSample)
+	n, _ := io.ReadFull(f, sample)
+	f.Close()
+	format := detectFormat(sample[:n])
+	if !format.binary && format != (fileFormat{eol: lf, enc: utf8Plain}) {
+		LogItAll.Printf("%s is %v with %v line endings, so it can't be mapped", fname, format.enc, format.eol)
+		return BufferizeFileWith(fname, backend)
+	}
+
+	b, err := mmapbuf.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	d := newDocument(b)
+	d.path = fname
+	d.format = format
+	d.large = true
+	d.disk = unsummedStamp(fi)
+	return d, nil
+}
+
+// unsummedStamp returns the stamp of a file too large to hash
+func unsummedStamp(fi os.FileInfo) fileStamp {
+	return fileStamp{modTime: fi.ModTime(), size: fi.Size(), known: true, unsummed: true}
+}
+
+// writeLarge writes a large document to the named file, straight from its
+// buffer
+func (d *document) writeLarge(name string) error {
+	src, ok := d.WriteBuffer.(io.WriterTo)
+	if !ok {
+		return fmt.Errorf("Can't write %s without copying it", name)
+	}
+	if err := atomicfile.Write(name, src, 0666); err != nil {
+		return err
+	}
+	if name == d.path {
+		if fi, err := os.Stat(name); err == nil {
+			d.disk = unsummedStamp(fi)
+		}
+		// map the file just written, so that the edits laid over the old
+		// one can go
+		if b, err := mmapbuf.Open(name); err == nil {
+			if c, ok := d.WriteBuffer.(io.Closer); ok {
+				c.Close()
+			}
+			d.WriteBuffer = b
+		}
+		d.markClean()
+	}
+	return nil
+}
+
+// reloadLarge maps a large document's file afresh. Its undo history is
+// cleared, as the old text it applies to is no longer kept.
+func (d *document) reloadLarge() error {
+	b, err := mmapbuf.Open(d.path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(d.path)
+	if err != nil {
+		b.Close()
+		return err
+	}
+	old := d.Len()
+	if c, ok := d.WriteBuffer.(io.Closer); ok {
+		c.Close()
+	}
+	d.WriteBuffer = b
+	d.history = newHistory()
+	d.edits++
+	d.markClean()
+	d.disk = unsummedStamp(fi)
+	d.notify(Change{Deleted: int64(old), Replaced: true})
+	return nil
+}
+
+// remapBroken reloads large documents whose file was cut short or rewritten
+// in place under their mapping, which leaves the mapping unreadable, and
+// reports whether there were any
+func (e *Editor) remapBroken() bool {
+	broken := false
+	for _, d := range e.documents() {
+		b, ok := d.WriteBuffer.(*mmapbuf.Buffer)
+		if !ok || b.Err() == nil {
+			continue
+		}
+		broken = true
+		if err := d.reloadLarge(); err != nil {
+			e.Message(d.path, ": ", err)
+			continue
+		}
+		e.Message(d.path, " was changed in place on disk, so it has been reloaded and any unsaved changes to it are lost")
+	}
+	return broken
+}
+
+// parseSize parses a number of bytes, which may be given in K, M or G
+func parseSize(s string) (int64, error) {
+	mult, digits := int64(1), s
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		digits = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("SetOption: bad size %s", s)
+	}
+	return n * mult, nil
+}
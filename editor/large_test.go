@@ -0,0 +1,159 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/millere/jk/atomicfile"
+	"github.com/millere/jk/keys"
+	"github.com/millere/jk/rope"
+)
+
+func TestLargeFile(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "file.txt")
+	os.WriteFile(name, []byte("one\ntwo\n"), 0644)
+
+	e := &Editor{options: DefaultOptions()}
+	e.options.LargeFileSize = 4
+	b, err := e.bufferize(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := b.(*document)
+	if !d.large {
+		t.Fatal("File wasn't opened in large-file mode")
+	}
+	d.WriteAt([]byte("zero\n"), 0)
+	if err := d.Write(""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "zero\none\ntwo\n" {
+		t.Errorf("Wrote %q", got)
+	}
+	if d.modified() {
+		t.Error("Still modified after saving")
+	}
+	if err := d.setFormat(fileFormat{enc: latin1}); err == nil || d.format.enc != utf8Plain {
+		t.Error("Changed the encoding of a large file, which is saved as it is")
+	}
+
+	os.WriteFile(name, []byte("three\n"), 0644)
+	if err := d.Write(""); err == nil {
+		t.Error("Saved over a file changed on disk")
+	}
+	if err := e.reload(d); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.Get(); got != "three\n" {
+		t.Errorf("Reloaded %q", got)
+	}
+	if !strings.Contains(e.message, "undo history") {
+		t.Errorf("Reloading didn't say the undo history was cleared: %q", e.message)
+	}
+
+	e.options.Backend = "rope"
+
+	crlf := filepath.Join(dir, "crlf.txt")
+	os.WriteFile(crlf, []byte("one\r\ntwo\r\n"), 0644)
+	b, err = e.bufferize(crlf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.(*document).large {
+		t.Error("A file with CRLF line endings was mapped")
+	}
+	if _, ok := b.(*document).WriteBuffer.(*rope.Rope); !ok {
+		t.Errorf("A file too large to map was loaded into a %T, not the rope backend", b.(*document).WriteBuffer)
+	}
+}
+
+func TestTruncatedLargeFile(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "file.log")
+	var text strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&text, "line %d\n", i)
+	}
+	os.WriteFile(name, []byte(text.String()), 0644)
+
+	e := testEditor()
+	e.options.LargeFileSize = 4
+	b, err := e.bufferize(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := e.ViewWithBuffer(b, "normal", 0, 0, 80, 24)
+	e.addView(&v)
+	v.SetCursor(4990, 0)
+
+	// truncate the file in place under the mapping, as log rotation does
+	os.WriteFile(name, []byte("short\n"), 0644)
+	if err := e.Do(keys.Keypress{Key: 'e'}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := v.buffer.back.Get(); got != "short\n" {
+		t.Errorf("Buffer holds %q after its file was truncated", got)
+	}
+	if !strings.Contains(e.message, "reloaded") {
+		t.Errorf("Truncating the file showed %q", e.message)
+	}
+	if v.buffer.C.Line > 1 {
+		t.Errorf("Cursor at %v, past the end of the truncated file", v.buffer.C)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{"100": 100, "4K": 4096, "64M": 64 << 20, "1G": 1 << 30}
+	for s, want := range cases {
+		if got, err := parseSize(s); got != want || err != nil {
+			t.Errorf("parseSize(%q) = %d, %v, expected %d", s, got, err, want)
+		}
+	}
+	if _, err := parseSize("lots"); err == nil {
+		t.Error("Parsed a size from lots")
+	}
+}
+
+func TestReloadLargeKeepsPositions(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "file.log")
+	os.WriteFile(name, []byte("one\ntwo\nthree\n"), 0644)
+
+	e := testEditor()
+	e.options.LargeFileSize = 4
+	b, err := e.bufferize(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := e.ViewWithBuffer(b, "normal", 0, 0, 80, 24)
+	v.SetCursor(1, 1)
+	v.SetMark("a")
+	v.SetCursor(2, 2)
+	v.SetPoint()
+
+	atomicfile.WriteFile(name, []byte("one\ntwo\nthree\nfour\n"), 0644)
+	if err := e.reload(v.buffer.back); err != nil {
+		t.Fatal(err)
+	}
+	if v.buffer.C != (Cursor{2, 2}) {
+		t.Errorf("Cursor at %v after the file grew, want {2 2}", v.buffer.C)
+	}
+	if v.buffer.Point.off != 10 {
+		t.Errorf("Point at %d after the file grew, want 10", v.buffer.Point.off)
+	}
+	if err := v.JumpToMark("a"); err != nil || v.buffer.C != (Cursor{1, 1}) {
+		t.Errorf("Jumped to %v, %v after the file grew, want {1 1}", v.buffer.C, err)
+	}
+
+	atomicfile.WriteFile(name, []byte("one\n"), 0644)
+	if err := e.reload(v.buffer.back); err != nil {
+		t.Fatal(err)
+	}
+	if v.buffer.Point.off > 4 {
+		t.Errorf("Point at %d, past the end of the shrunk file", v.buffer.Point.off)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import "fmt"
+
+// A mark is a position in a document that stays with the text after it as
+// the document is edited. Text inserted right at a mark goes before it.
+type mark struct {
+	off int64
+}
+
+// newMark returns a mark at off that the document keeps up to date
+func (d *document) newMark(off int64) *mark {
+	m := &mark{off: off}
+	d.marks = append(d.marks, m)
+	return m
+}
+
+// dropMark stops the document keeping m up to date
+func (d *document) dropMark(m *mark) {
+	for i, n := range d.marks {
+		if n == m {
+			d.marks = append(d.marks[:i], d.marks[i+1:]...)
+			return
+		}
+	}
+}
+
+// setMark puts the mark with the given name at off
+func (d *document) setMark(name string, off int64) {
+	if m, ok := d.named[name]; ok {
+		m.off = off
+		return
+	}
+	if d.named == nil {
+		d.named = make(map[string]*mark)
+	}
+	d.named[name] = d.newMark(off)
+}
+
+// adjustMarks moves the document's marks to account for c. Every document
+// subscribes to its own changes with it first, so that marks are up to date
+// by the time other subscribers hear about a change.
+func (d *document) adjustMarks(c Change) {
+	if c.Replaced {
+		d.clampMarks()
+		return
+	}
+	for _, m := range d.marks {
+		switch {
+		case m.off >= c.Off+c.Deleted:
+			m.off += int64(len(c.Inserted)) - c.Deleted
+		case m.off > c.Off:
+			m.off = c.Off
+		}
+	}
+}
+
+// clampMarks keeps the document's marks within its text after it has been
+// replaced wholesale
+func (d *document) clampMarks() {
+	n := int64(d.Len())
+	for _, m := range d.marks {
+		if m.off > n {
+			m.off = n
+		}
+	}
+}
+
+// A replayer makes edits to a document's buffer for its history, telling
+// the document's subscribers without recording the edits again
+type replayer struct {
+	WriteBuffer
+	d *document
+}
+
+// replay returns a buffer through which history can edit the document
+func (d *document) replay() replayer {
+	return replayer{d.WriteBuffer, d}
+}
+
+func (r replayer) WriteAt(p []byte, off int64) (int, error) {
+	n, err := r.WriteBuffer.WriteAt(p, off)
+	if n > 0 {
+		r.d.notify(Change{Off: off, Inserted: p[:n]})
+	}
+	return n, err
+}
+
+func (r replayer) Delete(n, off int64) {
+	r.WriteBuffer.Delete(n, off)
+	r.d.notify(Change{Off: off, Deleted: n})
+}
+
+// SetMark puts the mark with the given name at the cursor
+func (v *View) SetMark(name string) {
+	v.target.back.setMark(name, v.target.offsetOf(v.target.C))
+}
+
+// JumpToMark moves the cursor to the mark with the given name
+func (v *View) JumpToMark(name string) error {
+	m, ok := v.target.back.named[name]
+	if !ok {
+		return fmt.Errorf("No mark %s", name)
+	}
+	c := v.target.cursorAt(m.off)
+	v.SetCursor(c.Line, c.Column)
+	return nil
+}
+
+// SetMark returns a ModeFunc that sets the mark with the given name
+func SetMark(name string) ModeFunc {
+	return func(v *View, count int) error {
+		v.SetMark(name)
+		return nil
+	}
+}
+
+// JumpToMark returns a ModeFunc that jumps to the mark with the given name
+func JumpToMark(name string) ModeFunc {
+	return func(v *View, count int) error {
+		return v.JumpToMark(name)
+	}
+}
+
+// markNamedByKey returns a ModeFunc that waits for a key, and then runs the
+// ModeFunc f returns for the mark that key names
+func markNamedByKey(f func(name string) ModeFunc) ModeFunc {
+	return namedByKey("Marks", func(v *View, name string, count int) error {
+		return f(name)(v, count)
+	})
+}
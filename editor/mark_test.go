@@ -0,0 +1,54 @@
+package editor
+
+import "testing"
+
+func TestMarks(t *testing.T) {
+	d := getDocument("one two three")
+	d.setMark("a", 4)  // two
+	d.setMark("b", 8)  // three
+	d.setMark("c", 13) // the end
+
+	d.WriteAt([]byte("zero "), 0)
+	d.Delete(4, 5) // "one "
+	d.WriteAt([]byte("!"), 14)
+
+	edited := map[string]string{"a": "two three!", "b": "three!", "c": ""}
+	original := map[string]string{"a": "two three", "b": "three", "c": ""}
+	check := func(when string, expect map[string]string) {
+		text := contents(d)
+		for name, want := range expect {
+			if got := text[d.named[name].off:]; got != want {
+				t.Errorf("%s, mark %s is at %q, expected %q", when, name, got, want)
+			}
+		}
+	}
+	check("After editing", edited)
+
+	// marks move back with the text when edits are undone and redone
+	for i := 0; i < 3; i++ {
+		d.Undo()
+	}
+	check("After undoing", original)
+	for i := 0; i < 3; i++ {
+		d.Redo()
+	}
+	check("After redoing", edited)
+}
+
+func TestPoint(t *testing.T) {
+	d := getDocument("hello world")
+	v := &View{buffer: &subview{back: d}}
+	v.target = v.buffer
+	v.target.C = Cursor{0, 6}
+	v.SetPoint()
+	v.target.C = Cursor{0, 10}
+	d.WriteAt([]byte("big "), 0)
+	v.target.C = Cursor{0, 14}
+	if start, end, _ := v.buffer.region(); contents(d)[start:end+1] != "world" {
+		t.Errorf("Selection is %q after inserting before it", contents(d)[start:end+1])
+	}
+	v.ClearPoint()
+	if len(d.marks) != 0 {
+		t.Errorf("Cleared point is still kept up to date")
+	}
+}
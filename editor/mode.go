@@ -6,7 +6,8 @@ package editor
 
 import (
 	"bytes"
-	"errors"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/millere/jk/easybuf"
 	"github.com/millere/jk/keys"
@@ -21,11 +22,13 @@ type Mode struct {
 	OnEnter  func(v *View) error
 	OnExit   func(v *View) error
 	EventMap map[keys.Keypress]ModeFunc
+	Default  func(v *View, k keys.Keypress, count int) error // handles unbound keys
 }
 
 // Normal returns a simple normal mode for testing
 func Normal(e *Editor) Mode {
 	m := make(map[keys.Keypress]ModeFunc)
+	sharedBindings(e, m)
 	m[keys.Keypress{Key: 'h'}] = func(v *View, count int) error {
 		v.MoveCursor(-1, 0)
 		return nil
@@ -42,21 +45,14 @@ func Normal(e *Editor) Mode {
 		v.MoveCursor(1, 0)
 		return nil
 	}
-	m[keys.Keypress{Key: keys.Esc}] = func(v *View, count int) error {
-		return errors.New("Should quit")
-	}
 	m[keys.Keypress{Key: 't'}] = func(v *View, count int) error {
 		v.SetMode((*v.modes)["insert"], "insert")
 		return nil
 	}
-	m[keys.Keypress{Key: 'w'}] = func(v *View, count int) error {
-		return v.buffer.back.Write("")
-	}
-	m[keys.Keypress{Key: 'v'}] = func(v *View, count int) error {
-		v.TogglePoint()
-		return nil
-	}
 	m[keys.Keypress{Key: '<'}] = func(v *View, count int) error {
+		if v.choose != nil {
+			return v.Choose()
+		}
 		err := v.ExecInsertUnderCursor()
 		if err != nil {
 			LogItAll.Println(err)
@@ -77,13 +73,24 @@ func Normal(e *Editor) Mode {
 		e.addView(&vi)
 		return nil
 	}
-	m[keys.Keypress{Key: ']'}] = func(v *View, count int) error {
-		e.NextView()
-		return nil
+	m[keys.Keypress{Key: 'C'}] = e.viewCommands["cursor-at-next-match"]
+	m[keys.Keypress{Key: 'L'}] = e.viewCommands["cursors-on-lines"]
+	m[keys.Keypress{Key: 'K'}] = e.viewCommands["single-cursor"]
+	m[keys.Keypress{Key: '"'}] = chooseRegister
+	m[keys.Keypress{Key: 'y'}] = func(v *View, count int) error {
+		return v.Yank(e.takeRegister())
 	}
-	m[keys.Keypress{Key: 'g'}] = func(v *View, count int) error {
-		v.AlternateTag()
-		return nil
+	m[keys.Keypress{Key: 'd'}] = func(v *View, count int) error {
+		return v.DeleteSelection(e.takeRegister())
+	}
+	m[keys.Keypress{Key: 'p'}] = func(v *View, count int) error {
+		return v.Put(e.takeRegister(), true, count)
+	}
+	m[keys.Keypress{Key: 'P'}] = func(v *View, count int) error {
+		return v.Put(e.takeRegister(), false, count)
+	}
+	m[keys.Keypress{Key: keys.Enter}] = func(v *View, count int) error {
+		return v.Choose()
 	}
 
 	return Mode{
@@ -93,6 +100,33 @@ func Normal(e *Editor) Mode {
 	}
 }
 
+// sharedBindings binds the keys normal and hex modes have in common, for
+// quitting, saving, selecting, switching views, marks and undo
+func sharedBindings(e *Editor, m map[keys.Keypress]ModeFunc) {
+	m[keys.Keypress{Key: keys.Esc}] = e.viewCommands["quit"]
+	m[keys.Keypress{Key: 'w'}] = func(v *View, count int) error {
+		return v.buffer.back.Write("")
+	}
+	m[keys.Keypress{Key: 'v'}] = func(v *View, count int) error {
+		v.TogglePoint()
+		return nil
+	}
+	m[keys.Keypress{Key: ']'}] = func(v *View, count int) error {
+		e.NextView()
+		return nil
+	}
+	m[keys.Keypress{Key: 'g'}] = func(v *View, count int) error {
+		v.AlternateTag()
+		return nil
+	}
+	m[keys.Keypress{Key: 'm'}] = markNamedByKey(SetMark)
+	m[keys.Keypress{Key: '\''}] = markNamedByKey(JumpToMark)
+	m[keys.Keypress{Key: 'u'}] = e.viewCommands["undo"]
+	m[keys.Keypress{Key: 'U'}] = e.viewCommands["redo"]
+	m[keys.Keypress{Key: '-'}] = e.viewCommands["older"]
+	m[keys.Keypress{Key: '+'}] = e.viewCommands["newer"]
+}
+
 // Insert builds insert mode :)
 func Insert() Mode {
 	m := make(map[keys.Keypress]ModeFunc)
@@ -103,34 +137,41 @@ func Insert() Mode {
 	}
 	m[keys.Keypress{Key: keys.Backspace}] = func(v *View, count int) error {
 		v.DeleteBackwards()
-		v.MoveCursor(-1, 0)
 		return nil
 	}
 	m[keys.Keypress{Key: keys.Enter}] = func(v *View, count int) error {
 		v.InsertChar('\n')
-		v.SetCursor(v.target.C.Line+1, 0)
 		return nil
 	}
-
-	insertable := []byte{}
-	for c := byte(0x20); c <= 0x7E; c++ {
-		insertable = append(insertable, c)
+	m[keys.Keypress{Key: keys.Tab}] = func(v *View, count int) error {
+		v.InsertChar('\t')
+		return nil
 	}
 
-	for _, c := range insertable {
-		cc := c
-		m[keys.Keypress{Key: keys.Key(cc)}] = func(v *View, count int) error {
-			for i := 0; i < count; i++ {
-				v.InsertChar(cc)
-				v.MoveCursor(1, 0)
-			}
+	// Anything printable that isn't bound to something else is typed
+	insert := func(v *View, k keys.Keypress, count int) error {
+		r := rune(k.Key)
+		if k.Mod != 0 || r >= utf8.MaxRune || !unicode.IsPrint(r) {
+			LogItAll.Printf("No function bound to key %v", k)
 			return nil
 		}
+		for i := 0; i < count; i++ {
+			v.InsertChar(r)
+		}
+		return nil
 	}
 	return Mode{
-		OnEnter:  nil,
-		OnExit:   nil,
+		// Everything typed in one visit to insert mode is undone together
+		OnEnter: func(v *View) error {
+			v.target.back.history.Begin()
+			return nil
+		},
+		OnExit: func(v *View) error {
+			v.target.back.history.End()
+			return nil
+		},
 		EventMap: m,
+		Default:  insert,
 	}
 }
 
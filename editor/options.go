@@ -0,0 +1,88 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Options holds the user-settable configuration of an editor
+type Options struct {
+	Backend  string // the buffer implementation files are loaded into
+	TabWidth int    // the tab width buffers are opened with
+	// AutoReload makes unmodified buffers reload when their file changes
+	AutoReload bool
+	// LargeFileSize is the size from which files are mapped, not read
+	LargeFileSize int64
+	// Mouse makes clicks move cursors, which takes the mouse from the
+	// terminal's own selection
+	Mouse bool
+}
+
+// DefaultOptions returns the options an editor starts with
+func DefaultOptions() Options {
+	return Options{
+		Backend:       DefaultBackend,
+		TabWidth:      4,
+		LargeFileSize: DefaultLargeFileSize,
+	}
+}
+
+// SetOption sets the named option from its textual value
+func (e *Editor) SetOption(name, value string) error {
+	switch name {
+	case "backend":
+		if _, ok := Backends[value]; !ok {
+			return fmt.Errorf("SetOption: no such buffer backend %s", value)
+		}
+		e.options.Backend = value
+	case "tab-width":
+		n, err := parseTabWidth(value)
+		if err != nil {
+			return err
+		}
+		e.options.TabWidth = n
+	case "autoreload":
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("SetOption: autoreload must be true or false, not %s", value)
+		}
+		e.options.AutoReload = on
+		if on {
+			for _, d := range e.documents() {
+				e.watch(d)
+			}
+		}
+	case "large-file-size":
+		n, err := parseSize(value)
+		if err != nil {
+			return err
+		}
+		e.options.LargeFileSize = n
+	case "mouse":
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("SetOption: mouse must be true or false, not %s", value)
+		}
+		e.options.Mouse = on
+	case "clipboard-copy":
+		e.registers.clipboard.copy = strings.TrimSpace(value)
+	case "clipboard-paste":
+		e.registers.clipboard.paste = strings.TrimSpace(value)
+	default:
+		return fmt.Errorf("SetOption: no such option %s", name)
+	}
+	return nil
+}
+
+func parseTabWidth(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("SetOption: bad tab width %s", s)
+	}
+	return n, nil
+}
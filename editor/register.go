@@ -0,0 +1,243 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Unnamed is the name of the register yanks, deletions and puts use when
+// no other is given
+const Unnamed = `"`
+
+// DeletionHistory is how many deletions are kept in registers 1 to 9
+const DeletionHistory = 9
+
+// A register holds text that was yanked or deleted. Linewise text is made
+// of whole lines, and is put between lines rather than into one.
+type register struct {
+	text     string
+	linewise bool
+}
+
+// The registers are the unnamed register, the named registers a to z,
+// register 0 holding the last yank, registers 1 to 9 holding the last
+// deletions, most recent first, and the clipboard register. Yanking or
+// deleting into an uppercase name appends to the lowercase register.
+type registers struct {
+	regs      map[string]register
+	clipboard clipboard
+}
+
+// get returns the named register, or the unnamed one if name is empty
+func (r *registers) get(name string) (register, error) {
+	if name == "" {
+		name = Unnamed
+	}
+	if isClipboard(name) {
+		return r.clipboard.read()
+	}
+	reg, ok := r.regs[strings.ToLower(name)]
+	if !ok {
+		return register{}, fmt.Errorf("Register %s is empty", name)
+	}
+	return reg, nil
+}
+
+// set puts reg in the named register, if one is given, and the unnamed one
+func (r *registers) set(name string, reg register) error {
+	if r.regs == nil {
+		r.regs = make(map[string]register)
+	}
+	switch {
+	case name == "" || name == Unnamed:
+	case isClipboard(name):
+		if err := r.clipboard.write(reg); err != nil {
+			return err
+		}
+	case len(name) == 1 && 'a' <= name[0] && name[0] <= 'z':
+		r.regs[name] = reg
+	case len(name) == 1 && 'A' <= name[0] && name[0] <= 'Z':
+		name = strings.ToLower(name)
+		if old, ok := r.regs[name]; ok {
+			reg = register{old.text + reg.text, old.linewise && reg.linewise}
+		}
+		r.regs[name] = reg
+	default:
+		return fmt.Errorf("Can't write to register %s", name)
+	}
+	r.regs[Unnamed] = reg
+	return nil
+}
+
+// yanked stores yanked text in the named register and register 0
+func (r *registers) yanked(name string, reg register) error {
+	if err := r.set(name, reg); err != nil {
+		return err
+	}
+	r.regs["0"] = reg
+	return nil
+}
+
+// deleted stores deleted text in the named register, and adds it to the
+// deletion history
+func (r *registers) deleted(name string, reg register) error {
+	if err := r.set(name, reg); err != nil {
+		return err
+	}
+	for i := DeletionHistory; i > 1; i-- {
+		if prev, ok := r.regs[strconv.Itoa(i-1)]; ok {
+			r.regs[strconv.Itoa(i)] = prev
+		}
+	}
+	r.regs["1"] = reg
+	return nil
+}
+
+// selected returns the offsets of the first and last bytes of the
+// selection, or of the cursor's line if there isn't one, and whether they
+// make up whole lines
+func (s *subview) selected() (int64, int64, bool) {
+	start, end, ok := s.ordered()
+	if !ok {
+		start = s.back.OffsetOf(s.C.Line, 0)
+		line, _ := s.back.GetLine(s.C.Line)
+		return start, start + int64(len(line)) - 1, true
+	}
+	text, _ := s.back.FromTo(end, end)
+	return start, end, s.cursorAt(start).Column == 0 && text == "\n"
+}
+
+// selectedRegister returns what yanking the selection would store
+func (s *subview) selectedRegister() (register, int64, int64, error) {
+	start, end, linewise := s.selected()
+	if end < start {
+		return register{}, 0, 0, fmt.Errorf("Nothing to yank")
+	}
+	text, err := s.back.FromTo(start, end)
+	if err != nil {
+		return register{}, 0, 0, err
+	}
+	if linewise && !strings.HasSuffix(text, "\n") {
+		// the last line has no newline of its own
+		text += "\n"
+	}
+	return register{text, linewise}, start, end, nil
+}
+
+// Yank copies the selection, or the cursor's line if there isn't one, into
+// the named register
+func (v *View) Yank(name string) error {
+	reg, _, _, err := v.target.selectedRegister()
+	if err != nil {
+		return err
+	}
+	if err := v.parent.registers.yanked(name, reg); err != nil {
+		return err
+	}
+	v.ClearPoint()
+	return nil
+}
+
+// DeleteSelection deletes the selection, or the cursor's line if there
+// isn't one, into the named register
+func (v *View) DeleteSelection(name string) error {
+	s := v.target
+	reg, start, end, err := s.selectedRegister()
+	if err != nil {
+		return err
+	}
+	if err := v.parent.registers.deleted(name, reg); err != nil {
+		return err
+	}
+	v.ClearPoint()
+	s.back.Delete(end-start+1, start)
+	c := s.cursorAt(start)
+	v.SetCursor(c.Line, c.Column)
+	return nil
+}
+
+// Put inserts the contents of the named register count times, after the
+// cursor or before it. Linewise text goes after or before the cursor's
+// line. If there is a selection, it is replaced instead.
+func (v *View) Put(name string, after bool, count int) error {
+	reg, err := v.parent.registers.get(name)
+	if err != nil {
+		return err
+	}
+	if count < 1 {
+		count = 1
+	}
+	s := v.target
+	text := strings.Repeat(reg.text, count)
+	s.back.history.Begin()
+	defer s.back.history.End()
+
+	var off int64
+	switch start, end, selecting := s.ordered(); {
+	case selecting:
+		v.ClearPoint()
+		s.back.Delete(end-start+1, start)
+		off = start
+	case reg.linewise && after:
+		off = s.back.OffsetOf(s.C.Line+1, 0)
+		if s.C.Line+1 >= s.back.Lines() {
+			off = int64(s.back.Len())
+			if off > 0 {
+				if last, _ := s.back.FromTo(off-1, off-1); last != "\n" {
+					s.back.WriteAt([]byte{'\n'}, off)
+					off++
+				}
+			}
+		}
+	case reg.linewise:
+		off = s.back.OffsetOf(s.C.Line, 0)
+	default:
+		off = s.offsetOf(s.C)
+		if line, err := s.back.GetLine(s.C.Line); after && err == nil {
+			if at := columnOffset(line, s.C.Column); at < len(lineText(line)) {
+				off += int64(graphemeLen(line[at:]))
+			}
+		}
+	}
+	if _, err := s.back.WriteAt([]byte(text), off); err != nil {
+		return err
+	}
+	// the cursor goes to the start of put lines, or the end of put text
+	c := s.cursorAt(off)
+	if !reg.linewise {
+		c = s.cursorAt(off + int64(len(text)) - 1)
+	}
+	v.SetCursor(c.Line, c.Column)
+	return nil
+}
+
+// takeRegister returns the register chosen for the next yank, deletion or
+// put, and forgets the choice
+func (e *Editor) takeRegister() string {
+	name := e.register
+	e.register = ""
+	return name
+}
+
+// chooseRegister is a ModeFunc that has the next key name the register the
+// following yank, deletion or put uses
+var chooseRegister = namedByKey("Registers", func(v *View, name string, count int) error {
+	v.parent.register = name
+	return nil
+})
+
+// optionalRegister returns the register named by args, if any
+func optionalRegister(command string, args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return "", nil
+	case 1:
+		return args[0], nil
+	}
+	return "", fmt.Errorf("%s: expected at most a register name", command)
+}
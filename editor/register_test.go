@@ -0,0 +1,115 @@
+package editor
+
+import (
+	"testing"
+
+	"github.com/millere/jk/keys"
+)
+
+func TestYankAndPut(t *testing.T) {
+	v := cursorView(t, "one\ntwo\nthree")
+	v.SetCursor(0, 1)
+	v.SetPoint()
+	v.SetCursor(0, 2)
+	if err := v.Yank("a"); err != nil {
+		t.Fatal(err)
+	}
+	v.SetCursor(1, 0)
+	if err := v.Put("a", true, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(v.buffer.back); got != "one\ntnenewo\nthree" {
+		t.Errorf("Putting a characterwise register twice gave %q", got)
+	}
+	if v.buffer.C != (Cursor{1, 4}) {
+		t.Errorf("Cursor at %v after a characterwise put, want {1 4}", v.buffer.C)
+	}
+	if err := v.Yank(""); err != nil {
+		t.Fatal(err)
+	}
+	v.SetCursor(2, 2)
+	if err := v.Put("", true, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(v.buffer.back); got != "one\ntnenewo\nthree\ntnenewo\n" {
+		t.Errorf("Putting a yanked last line after the last line gave %q", got)
+	}
+	if err := v.Put("a", false, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(v.buffer.back); got != "one\ntnenewo\nthree\nnetnenewo\n" {
+		t.Errorf("Putting before the cursor gave %q", got)
+	}
+	if err := v.Put("b", true, 1); err == nil {
+		t.Errorf("Putting from an empty register didn't fail")
+	}
+}
+
+func TestDeletionHistory(t *testing.T) {
+	v := cursorView(t, "one\ntwo\nthree\n")
+	for i := 0; i < 2; i++ {
+		if err := v.DeleteSelection(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := contents(v.buffer.back); got != "three\n" {
+		t.Errorf("Deleting two lines left %q", got)
+	}
+	regs := &v.parent.registers
+	for name, want := range map[string]string{"1": "two\n", "2": "one\n", Unnamed: "two\n"} {
+		if reg, err := regs.get(name); err != nil || reg.text != want || !reg.linewise {
+			t.Errorf("Register %s holds %+v, %v, want linewise %q", name, reg, err, want)
+		}
+	}
+	if err := v.Put("2", false, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(v.buffer.back); got != "one\nthree\n" {
+		t.Errorf("Putting an older deletion before the line gave %q", got)
+	}
+}
+
+func TestPutIntoEmptyBuffer(t *testing.T) {
+	v := cursorView(t, "")
+	v.InsertChar('a')
+	if err := v.Yank(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.DeleteSelection(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Put("", true, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(v.buffer.back); got != "a\n" {
+		t.Errorf("Putting a line into an empty buffer gave %q", got)
+	}
+}
+
+func TestRegisterAppend(t *testing.T) {
+	var regs registers
+	regs.yanked("a", register{"one ", false})
+	regs.yanked("A", register{"two", false})
+	if reg, _ := regs.get("a"); reg.text != "one two" || reg.linewise {
+		t.Errorf("Appending to register a gave %+v", reg)
+	}
+	if reg, _ := regs.get("0"); reg.text != "two" {
+		t.Errorf("Register 0 holds %+v after the last yank of %q", reg, "two")
+	}
+	if err := regs.yanked("%", register{"x", false}); err == nil {
+		t.Errorf("Yanking into register %% didn't fail")
+	}
+}
+
+func TestChooseRegister(t *testing.T) {
+	v := cursorView(t, "one\ntwo\n")
+	for _, k := range []keys.Key{'"', 'a', 'y', '"', keys.Tab} {
+		v.Do(keys.Keypress{Key: k})
+	}
+	if reg, err := v.parent.registers.get("a"); err != nil || reg.text != "one\n" {
+		t.Errorf("Register a holds %+v, %v after yanking into it by key", reg, err)
+	}
+	if v.parent.register != "" {
+		t.Errorf("Register %q was chosen by Tab", v.parent.register)
+	}
+}
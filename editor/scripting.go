@@ -46,10 +46,20 @@ func (e *Editor) Interpret(sexp, in string) ([]byte, error) {
 
 func (e *Editor) InterpretInternal(parts []string) error {
 	fn, ok := e.viewCommands[parts[0]]
+	if ok {
+		if err := fn(e.views[e.currentView], 1); err != nil {
+			e.Message(err)
+		}
+		return nil
+	}
+	// editor commands are the ones that take arguments
+	efn, ok := e.editorCommands[parts[0]]
 	if !ok {
 		return fmt.Errorf(`Interpret: "%v": function not found`, parts[0])
 	}
-	fn(e.views[e.currentView], 1)
+	if err := efn(e, parts[1:]...); err != nil {
+		e.Message(err)
+	}
 
 	return nil
 }
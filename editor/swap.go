@@ -0,0 +1,195 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/millere/jk/atomicfile"
+)
+
+// SwapInterval is the longest a modified buffer goes without its swap file
+// being brought up to date, as long as keys are being pressed
+const SwapInterval = 2 * time.Second
+
+// A swapFile holds the text of a modified buffer, so that it can be
+// recovered if jk exits without saving it
+type swapFile struct {
+	Path string    // the absolute path of the file being edited
+	PID  int       // the process that wrote the swap file
+	Time time.Time // when the swap file was written
+	Text []byte
+}
+
+// swapState is what a document knows about its swap file
+type swapState struct {
+	edits    int       // the document's edit count when the swap was written
+	written  time.Time // when the swap was last written
+	exists   bool      // whether this process has written a swap file
+	leftover *swapFile // a swap file found when loading, not yet dealt with
+}
+
+// swapName returns the name of the swap file for the file at path
+func swapName(path string) (string, error) {
+	return cacheFile("swap", path)
+}
+
+// readSwap reads the swap file left for the file at path, returning nil if
+// there isn't one
+func readSwap(path string) (*swapFile, error) {
+	name, err := swapName(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sw := new(swapFile)
+	if err := gob.NewDecoder(f).Decode(sw); err != nil {
+		return nil, fmt.Errorf("Reading swap file for %s: %v", path, err)
+	}
+	return sw, nil
+}
+
+// writeSwap brings the document's swap file up to date
+func (d *document) writeSwap() error {
+	if d.path == "" || d.swap.leftover != nil {
+		// don't clobber a swap file the user hasn't dealt with
+		return nil
+	}
+	name, err := swapName(d.path)
+	if err != nil {
+		return err
+	}
+	text, err := d.Get()
+	if err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(d.path)
+	sw := swapFile{Path: abs, PID: os.Getpid(), Time: time.Now(), Text: []byte(text)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&sw); err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(name, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	d.swap.edits = d.edits
+	d.swap.written = sw.Time
+	d.swap.exists = true
+	return nil
+}
+
+// updateSwap writes the swap file if the document has changed since it was
+// last written, and it was last written at least SwapInterval ago. A
+// document that matches its file again, having been reloaded or undone to
+// where it was saved, has its swap file removed instead.
+func (d *document) updateSwap() error {
+	if d.large || d.edits == d.swap.edits {
+		return nil
+	}
+	if !d.modified() {
+		d.removeSwap()
+		return nil
+	}
+	if time.Since(d.swap.written) < SwapInterval {
+		return nil
+	}
+	return d.writeSwap()
+}
+
+// removeSwap removes the swap file this process wrote for the document
+func (d *document) removeSwap() {
+	if !d.swap.exists {
+		return
+	}
+	if name, err := swapName(d.path); err == nil {
+		os.Remove(name)
+	}
+	d.swap.exists = false
+	d.swap.edits = d.edits
+}
+
+// checkSwap looks for a swap file left behind for the document, and returns
+// a warning about it if there is one
+func (d *document) checkSwap() string {
+	sw, err := readSwap(d.path)
+	if err != nil {
+		return err.Error()
+	}
+	if sw == nil {
+		return ""
+	}
+	d.swap.leftover = sw
+	return fmt.Sprintf("%s has a swap file from %s (pid %d): swap-recover, swap-diff or swap-discard",
+		d.path, sw.Time.Format("2006-01-02 15:04:05"), sw.PID)
+}
+
+// recoverSwap replaces the text of the document with that of the leftover
+// swap file. The replacement can be undone.
+func (d *document) recoverSwap() error {
+	sw := d.swap.leftover
+	if sw == nil {
+		return errors.New("swap-recover: no swap file to recover")
+	}
+	d.replace(sw.Text)
+	d.swap.leftover = nil
+	return d.writeSwap()
+}
+
+// discardSwap removes the leftover swap file
+func (d *document) discardSwap() error {
+	if d.swap.leftover == nil {
+		return errors.New("swap-discard: no swap file to discard")
+	}
+	d.swap.leftover = nil
+	name, err := swapName(d.path)
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// diffSwap returns a diff between the file on disk and the leftover swap
+func (d *document) diffSwap() ([]byte, error) {
+	if d.swap.leftover == nil {
+		return nil, errors.New("swap-diff: no swap file to compare")
+	}
+	raw, err := d.format.encode(d.swap.leftover.Text)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp("", "jk-swap-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(raw)
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+	orig := d.path
+	if _, err := os.Stat(orig); os.IsNotExist(err) {
+		orig = os.DevNull // the file was never saved
+	}
+	out, err := exec.Command("diff", "-u", orig, tmp.Name()).Output()
+	// diff exits with 1 when the files differ
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == 1 {
+		err = nil
+	}
+	return out, err
+}
@@ -0,0 +1,60 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSwapRecovery(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "file.txt")
+	os.WriteFile(name, []byte("saved\n"), 0644)
+
+	b, _ := BufferizeFile(name)
+	d := b.(*document)
+	d.WriteAt([]byte("unsaved "), 0)
+	if err := d.updateSwap(); err != nil {
+		t.Fatal(err)
+	}
+	// jk dies here, leaving the swap file behind
+
+	b, _ = BufferizeFile(name)
+	d = b.(*document)
+	if d.checkSwap() == "" {
+		t.Fatal("Leftover swap file wasn't found")
+	}
+	d.WriteAt([]byte("!"), 0)
+	d.updateSwap()
+	if sw, _ := readSwap(name); string(sw.Text) != "unsaved saved\n" {
+		t.Errorf("Leftover swap file was overwritten with %q", sw.Text)
+	}
+	if err := d.recoverSwap(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.Get(); got != "unsaved saved\n" {
+		t.Errorf("Recovered %q", got)
+	}
+	d.Undo()
+	if got, _ := d.Get(); got != "!saved\n" {
+		t.Errorf("Undoing recovery gave %q", got)
+	}
+
+	d.Write("")
+	if sw, _ := readSwap(name); sw != nil {
+		t.Errorf("Saving didn't remove the swap file")
+	}
+
+	d.WriteAt([]byte("?"), 0)
+	d.swap.written = time.Time{} // as if SwapInterval had passed
+	d.updateSwap()
+	if sw, _ := readSwap(name); sw == nil {
+		t.Fatal("No swap file was written for an edit after saving")
+	}
+	d.Undo()
+	d.updateSwap()
+	if sw, _ := readSwap(name); sw != nil {
+		t.Errorf("Undoing back to the saved text left a swap file of %q", sw.Text)
+	}
+}
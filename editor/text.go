@@ -0,0 +1,151 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Columns in jk count graphemes: a character along with any combining marks
+// or joined characters that follow it, which the user sees as one thing.
+// The functions here convert between columns, byte offsets in a line, and
+// the terminal cells a line is drawn in.
+
+const zeroWidthJoiner = '\u200d'
+
+// extends reports whether r joins onto the grapheme before it
+func extends(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r == zeroWidthJoiner ||
+		(r >= 0x1f3fb && r <= 0x1f3ff) // emoji skin tone modifiers
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// graphemeLen returns the length in bytes of the grapheme s starts with
+func graphemeLen(s string) int {
+	if s == "" {
+		return 0
+	}
+	r, i := utf8.DecodeRuneInString(s)
+	if r == '\n' || r == '\r' {
+		return i
+	}
+	flag := isRegionalIndicator(r) // flags are pairs of regional indicators
+	joined := false
+	for i < len(s) {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\n' || r == '\r':
+			return i
+		case joined || extends(r):
+		case flag && isRegionalIndicator(r):
+			flag = false
+		default:
+			return i
+		}
+		joined = r == zeroWidthJoiner
+		i += n
+	}
+	return i
+}
+
+// lineText returns line without its line ending. A '\r' before the '\n'
+// is part of the ending, which happens in files that mix line endings.
+func lineText(line string) string {
+	if strings.HasSuffix(line, "\r\n") {
+		return line[:len(line)-2]
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// columns returns the number of columns in line, not counting its ending
+func columns(line string) int {
+	line = lineText(line)
+	n := 0
+	for i := 0; i < len(line); i += graphemeLen(line[i:]) {
+		n++
+	}
+	return n
+}
+
+// columnOffset returns the byte offset of column col in line. Columns past
+// the end of the line give the offset of its ending.
+func columnOffset(line string, col int) int {
+	line = lineText(line)
+	i := 0
+	for ; col > 0 && i < len(line); col-- {
+		i += graphemeLen(line[i:])
+	}
+	return i
+}
+
+// columnAt returns the column containing the byte at off in line. Bytes of
+// the line's ending are in the column after its last character.
+func columnAt(line string, off int) int {
+	line = lineText(line)
+	col := 0
+	for i := 0; i < len(line); col++ {
+		i += graphemeLen(line[i:])
+		if i > off {
+			return col
+		}
+	}
+	return col
+}
+
+// graphemeWidth returns the number of terminal cells grapheme g takes up
+// when drawn starting at cell x, with tab stops every tabWidth cells
+func graphemeWidth(g string, x, tabWidth int) int {
+	r, n := utf8.DecodeRuneInString(g)
+	if r == '\t' && tabWidth > 0 {
+		return tabWidth - x%tabWidth
+	}
+	if isRegionalIndicator(r) && len(g) > n {
+		return 2 // a flag
+	}
+	if strings.ContainsRune(g, '\ufe0f') {
+		return 2 // presented as an emoji
+	}
+	if w := runewidth.RuneWidth(r); w > 0 {
+		return w
+	}
+	// give control characters a cell so the cursor can sit on them
+	return 1
+}
+
+// cellOf returns the first cell column col of line is drawn in
+func cellOf(line string, col, tabWidth int) int {
+	line = lineText(line)
+	x := 0
+	for i := 0; col > 0 && i < len(line); col-- {
+		n := graphemeLen(line[i:])
+		x += graphemeWidth(line[i:i+n], x, tabWidth)
+		i += n
+	}
+	return x + col
+}
+
+// columnAtCell returns the column of line drawn in cell x. Cells past the
+// end of the line give the column of its ending.
+func columnAtCell(line string, x, tabWidth int) int {
+	line = lineText(line)
+	col := 0
+	for i, cell := 0, 0; i < len(line); col++ {
+		n := graphemeLen(line[i:])
+		cell += graphemeWidth(line[i:i+n], cell, tabWidth)
+		if cell > x {
+			return col
+		}
+		i += n
+	}
+	return col
+}
@@ -0,0 +1,76 @@
+package editor
+
+import "testing"
+
+func TestColumns(t *testing.T) {
+	cases := []struct {
+		line    string
+		columns int
+	}{
+		{"hello\n", 5},
+		{"crlf\r\n", 4},
+		{"héllo", 5},
+		{"he\u0301llo", 5},
+		{"日本語\n", 3},
+		{"👍🏽 ok", 4},
+		{"🇳🇿🇯🇵", 2},
+		{"👩\u200d💻!", 2},
+	}
+	for i, c := range cases {
+		if got := columns(c.line); got != c.columns {
+			t.Errorf("Case %d: %q has %d columns, expected %d", i, c.line, got, c.columns)
+		}
+	}
+}
+
+func TestColumnOffset(t *testing.T) {
+	line := "aé日\u0301b\n"
+	offsets := []int{0, 1, 3, 8, 9, 9}
+	for col, expect := range offsets {
+		if got := columnOffset(line, col); got != expect {
+			t.Errorf("Column %d: got offset %d, expected %d", col, got, expect)
+		}
+	}
+	for col, off := range offsets[:5] {
+		if got := columnAt(line, off); got != col {
+			t.Errorf("Offset %d: got column %d, expected %d", off, got, col)
+		}
+	}
+	if got := columnAt(line, 4); got != 2 {
+		t.Errorf("Offset inside a character: got column %d, expected 2", got)
+	}
+}
+
+func TestCells(t *testing.T) {
+	line := "a日e\u0301🇳🇿b\n"
+	cells := []int{0, 1, 3, 4, 6, 7}
+	for col, expect := range cells {
+		if got := cellOf(line, col, 4); got != expect {
+			t.Errorf("Column %d: got cell %d, expected %d", col, got, expect)
+		}
+	}
+	columns := []int{0, 1, 1, 2, 3, 3, 4, 5, 5}
+	for x, expect := range columns {
+		if got := columnAtCell(line, x, 4); got != expect {
+			t.Errorf("Cell %d: got column %d, expected %d", x, got, expect)
+		}
+	}
+}
+
+func TestTabs(t *testing.T) {
+	line := "\tab\tc\t\n"
+	cells := []int{0, 8, 9, 10, 16, 17, 24}
+	for col, expect := range cells {
+		if got := cellOf(line, col, 8); got != expect {
+			t.Errorf("Column %d: got cell %d, expected %d", col, got, expect)
+		}
+	}
+	for x, expect := range map[int]int{0: 0, 7: 0, 8: 1, 10: 3, 15: 3, 16: 4, 20: 5} {
+		if got := columnAtCell(line, x, 8); got != expect {
+			t.Errorf("Cell %d: got column %d, expected %d", x, got, expect)
+		}
+	}
+	if got := cellOf("ab\tc", 3, 4); got != 4 {
+		t.Errorf("Tab after text: got cell %d, expected 4", got)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/millere/jk/atomicfile"
+)
+
+// cacheDir returns the directory jk keeps the named kind of cached
+// files in, creating it if needed
+func cacheDir(kind string) (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, "jk", kind)
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// cacheFile returns the name of the file in the cache directory of the
+// given kind that belongs to the file at path
+func cacheFile(kind, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	dir, err := cacheDir(kind)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])), nil
+}
+
+// An undoFile is the form a history is saved to disk in
+type undoFile struct {
+	Path   string // the absolute path of the file the history is for
+	Hash   []byte // the sha256 of the file's contents when it was saved
+	Cur    int    // the seq of the state the file was saved in
+	States []undoState
+}
+
+type undoState struct {
+	Parent int // -1 for the root
+	Next   int // -1 if there is nothing to redo
+	Time   time.Time
+	Edits  []undoEdit
+}
+
+type undoEdit struct {
+	Off      int64
+	Deleted  []byte
+	Inserted []byte
+}
+
+// saveHistory writes the history of d to the cache, to be restored when
+// the file at path is next loaded with the contents hashed by sum
+func (d *document) saveHistory(path string, sum []byte) error {
+	name, err := cacheFile("undo", path)
+	if err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(path)
+	u := undoFile{Path: abs, Hash: sum, Cur: d.history.cur.seq}
+	for _, s := range d.history.states {
+		us := undoState{Parent: -1, Next: -1, Time: s.time}
+		if s.parent != nil {
+			us.Parent = s.parent.seq
+		}
+		if s.next != nil {
+			us.Next = s.next.seq
+		}
+		for _, e := range s.step {
+			us.Edits = append(us.Edits, undoEdit{e.off, e.deleted, e.inserted})
+		}
+		u.States = append(u.States, us)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&u); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(name, buf.Bytes(), 0600)
+}
+
+// loadHistory restores the saved history of the file at path, if it was
+// saved when the file's contents hashed to sum. A history saved for
+// different contents is removed.
+func (d *document) loadHistory(path string, sum []byte) error {
+	name, err := cacheFile("undo", path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var u undoFile
+	if err := gob.NewDecoder(f).Decode(&u); err != nil {
+		os.Remove(name)
+		return fmt.Errorf("loadHistory: %s: %v", path, err)
+	}
+	abs, _ := filepath.Abs(path)
+	if u.Path != abs || !bytes.Equal(u.Hash, sum) {
+		os.Remove(name)
+		return errors.New("loadHistory: " + path + " changed since its history was saved")
+	}
+	h, err := u.history()
+	if err != nil {
+		os.Remove(name)
+		return fmt.Errorf("loadHistory: %s: %v", path, err)
+	}
+	d.history = h
+	d.markClean()
+	return nil
+}
+
+// history rebuilds the history tree u describes
+func (u *undoFile) history() (history, error) {
+	n := len(u.States)
+	if n == 0 || u.States[0].Parent != -1 || u.Cur < 0 || u.Cur >= n {
+		return history{}, errors.New("malformed history")
+	}
+	states := make([]*state, n)
+	for i, us := range u.States {
+		s := &state{seq: i, time: us.Time}
+		if i > 0 {
+			if us.Parent < 0 || us.Parent >= i || len(us.Edits) == 0 {
+				return history{}, errors.New("malformed history")
+			}
+			s.parent = states[us.Parent]
+			s.depth = s.parent.depth + 1
+			s.parent.children = append(s.parent.children, s)
+		}
+		for _, e := range us.Edits {
+			s.step = append(s.step, edit{e.Off, e.Deleted, e.Inserted})
+		}
+		states[i] = s
+	}
+	for i, us := range u.States {
+		if us.Next != -1 {
+			if us.Next <= i || us.Next >= n || states[us.Next].parent != states[i] {
+				return history{}, errors.New("malformed history")
+			}
+			states[i].next = states[us.Next]
+		}
+	}
+	return history{
+		root:   states[0],
+		cur:    states[u.Cur],
+		states: states,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistentHistory(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "file.txt")
+	os.WriteFile(name, []byte("hello\n"), 0644)
+
+	b, err := BufferizeFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.WriteAt([]byte("oh, "), 0)
+	if err := b.Write(""); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = BufferizeFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := b.(*document)
+	if d.Undo() == -1 {
+		t.Fatal("History wasn't restored")
+	}
+	if got, _ := d.Get(); got != "hello\n" {
+		t.Errorf("Undo of restored history gave %q", got)
+	}
+
+	os.WriteFile(name, []byte("changed\n"), 0644)
+	b, err = BufferizeFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.(*document).Undo() != -1 {
+		t.Errorf("History was restored for a changed file")
+	}
+	if f, _ := cacheFile("undo", name); fileExists(f) {
+		t.Errorf("History for a changed file wasn't removed")
+	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
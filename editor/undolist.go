@@ -0,0 +1,62 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// timeTravel parses the argument to Earlier or Later, which is either a
+// number of states or a duration like 5m
+func timeTravel(args []string) (int, time.Duration, error) {
+	if len(args) == 0 {
+		return 1, 0, nil
+	}
+	if n, err := strconv.Atoi(args[0]); err == nil {
+		return n, 0, nil
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("expected a count or a duration, got %s", args[0])
+	}
+	return 0, d, nil
+}
+
+// ShowUndoList opens a view listing the branches of the target buffer's
+// history. Executing a line of it restores that state in v, and closes the
+// list.
+func (e *Editor) ShowUndoList(v *View) error {
+	d := v.target.back
+	var buf bytes.Buffer
+	var seqs []int
+	fmt.Fprintln(&buf, "state  time      changes")
+	for _, s := range d.history.branches() {
+		current := ""
+		if s == d.history.cur {
+			current = "  (current)"
+		}
+		fmt.Fprintf(&buf, "%5d  %s  %7d%s\n",
+			s.seq, s.time.Format("15:04:05"), s.depth, current)
+		seqs = append(seqs, s.seq)
+	}
+
+	list, err := e.showText(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	list.choose = func(line int) error {
+		if line < 1 || line > len(seqs) {
+			return nil
+		}
+		v.travel(d.Jump(seqs[line-1]))
+		e.removeView(list)
+		e.focus(v)
+		return nil
+	}
+	return nil
+}
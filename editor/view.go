@@ -6,8 +6,8 @@ package editor
 
 import (
 	"fmt"
-	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/millere/jk/keys"
 	"github.com/millere/jk/tagbuf"
@@ -25,14 +25,24 @@ type View struct {
 	modeName   string
 	modes      *map[string]*Mode
 	target     *subview
+	nextKey    func(v *View, k keys.Keypress) error // takes the next keypress, if set
+	choose     func(line int) error                 // run when a line of the buffer is executed
 }
 
 type subview struct {
 	area      *window.Area // the area the buffer is rendered to
 	C         Cursor       // the position of the cursor
-	Point     *Cursor      // the position of the point, which when defined sets the selection
-	back      WriteBuffer  // the backing buffer
+	Point     *mark        // the point, which when defined sets the selection
+	back      *document    // the backing buffer
 	firstLine int          // the first line of the buffer to be displayed, for scrolling
+	hex       bool         // whether the buffer is shown as hex bytes, HexRowBytes to a line
+	nibble    int          // in hex, which half of the byte under the cursor is typed over next
+	ascii     bool         // in hex, whether typing goes to the ASCII gutter
+	at        *mark        // where the cursor is in the text, so it follows edits
+	extra     []*selection // more cursors, which edits and motions also apply to
+	x, y      int          // where the area is on the screen
+	w, h      int          // the size of the area, less any status bar over it
+	unfollow  func()       // stops the cursor following the buffer
 }
 
 // A Cursor indicates where the cursor is
@@ -47,6 +57,10 @@ func (e *Editor) ViewWithBuffer(a WriteBuffer, m string, x, y, w, h int) (View,
 	if !ok {
 		return View{}, fmt.Errorf("Mode \"%v\" does not exist", m)
 	}
+	doc := newDocument(a)
+	if doc.tabWidth == 0 {
+		doc.tabWidth = e.options.TabWidth
+	}
 	tagarea := window.New(x, y, w, 1)
 	bufarea := window.New(x, y+1, w, h-1)
 	statusarea := window.New(x, y+h-1, w, 1)
@@ -55,12 +69,16 @@ func (e *Editor) ViewWithBuffer(a WriteBuffer, m string, x, y, w, h int) (View,
 		buffer: &subview{
 			area: bufarea,
 			C:    Cursor{0, 0},
-			back: a,
+			back: doc,
+			x:    x,
+			y:    y + 1,
+			w:    w,
+			h:    h - 2,
 		},
 		tag: &subview{
 			area: tagarea,
 			C:    Cursor{0, 0},
-			back: tagbuf.New(),
+			back: newDocument(tagbuf.New()),
 		},
 
 		mode:       mode,
@@ -69,9 +87,28 @@ func (e *Editor) ViewWithBuffer(a WriteBuffer, m string, x, y, w, h int) (View,
 		statusArea: statusarea,
 	}
 	v.target = v.buffer
+	v.buffer.follow()
 	return v, nil
 }
 
+// follow keeps the subview's cursor on the same text as its buffer is
+// edited, whether through this view or another
+func (s *subview) follow() {
+	s.at = s.back.newMark(s.offsetOf(s.C))
+	cancel := s.back.Subscribe(func(c Change) {
+		s.C = s.cursorAt(s.at.off)
+		s.scroll()
+	})
+	s.unfollow = func() {
+		cancel()
+		s.back.dropMark(s.at)
+		if s.Point != nil {
+			s.back.dropMark(s.Point)
+		}
+		s.dropCursors()
+	}
+}
+
 // Draw draws a View into its area
 func (v *View) Draw() {
 	v.drawTag()
@@ -84,40 +121,62 @@ func (v *View) drawTag() {
 	_, w := v.tag.area.Size()
 	v.tag.area.WriteLine(line, 0, 0, w, termbox.ColorBlack, termbox.ColorWhite)
 	if v.tag == v.target {
-		v.tag.area.SetCursor(v.tag.C.Column, 0)
+		v.tag.area.SetCursor(cellOf(line, v.tag.C.Column, v.tag.back.tabWidth), 0)
 	}
 }
 
 func (v *View) drawBuffer() {
-	tabStop := 4
-	var tabsAtCursor int
+	if v.buffer.hex {
+		v.drawHex()
+		return
+	}
 	v.buffer.area.Clear()
+	start, end, selecting := v.buffer.region()
+	tabWidth := v.buffer.back.tabWidth
+	cursors, selected := v.buffer.extraCursors()
 
 	_, h := v.buffer.area.Size()
 	for l := 0; l < h; l++ {
-		tabs := 0
 		line, err := v.buffer.back.GetLine(l + v.buffer.firstLine)
-		if l+v.buffer.firstLine == v.buffer.C.Line && v.buffer.C.Column-1 >= 0 {
-			tabsAtCursor = strings.Count(line[:v.buffer.C.Column-1], "\t")
-		}
 		if err != nil {
 			break
 		}
-		for i, c := range line {
-			if c == '\t' {
-				tabs++
-			}
+		lineOff := v.buffer.back.OffsetOf(l+v.buffer.firstLine, 0)
+		text := lineText(line)
+		for i, x := 0, 0; i < len(text); {
+			n := graphemeLen(text[i:])
+			w := graphemeWidth(text[i:i+n], x, tabWidth)
+			// termbox can't combine characters, so only the first is drawn
+			c, _ := utf8.DecodeRuneInString(text[i:])
 			bg := termbox.ColorDefault
 			fg := termbox.ColorDefault
-			if v.buffer.InRegion(l+v.buffer.firstLine, i) {
+			off := lineOff + int64(i)
+			if selecting && start <= off && off <= end || selected(off) {
 				bg = termbox.ColorRed
 			}
-			v.buffer.area.SetCell(i+tabStop*tabs,
-				l, c, fg, bg)
+			if cursors[off] {
+				fg, bg = termbox.ColorBlack, termbox.ColorWhite
+			}
+			if c == '\t' {
+				for j := 0; j < w; j++ {
+					v.buffer.area.SetCell(x+j, l, ' ', fg, bg)
+				}
+			} else {
+				v.buffer.area.SetCell(x, l, c, fg, bg)
+			}
+			x += w
+			i += n
+			if i == len(text) && cursors[lineOff+int64(i)] {
+				v.buffer.area.SetCell(x, l, ' ', termbox.ColorBlack, termbox.ColorWhite)
+			}
+		}
+		if len(text) == 0 && cursors[lineOff] {
+			v.buffer.area.SetCell(0, l, ' ', termbox.ColorBlack, termbox.ColorWhite)
 		}
 	}
 	if v.buffer == v.target {
-		v.buffer.area.SetCursor(v.buffer.C.Column+4*tabsAtCursor,
+		line, _ := v.buffer.back.GetLine(v.buffer.C.Line)
+		v.buffer.area.SetCursor(cellOf(line, v.buffer.C.Column, tabWidth),
 			v.buffer.C.Line-v.buffer.firstLine)
 	}
 }
@@ -130,49 +189,62 @@ func (v *View) drawStatusBar() {
 		v.parent.currentView+1,
 		len(v.parent.views),
 	)
+	if v.buffer.back.modified() {
+		modeline += " [modified]"
+	}
+	if enc := v.buffer.back.format.enc; enc != utf8Plain {
+		modeline += " [" + enc.String() + "]"
+	}
+	if eol := v.buffer.back.format.eol; eol != lf {
+		modeline += " [" + eol.String() + "]"
+	}
+	if v.buffer.back.large {
+		modeline += " [large]"
+	}
+	if v.buffer.back.format.binary {
+		modeline += " [binary]"
+	}
+	if v.parent.message != "" {
+		modeline += "  " + v.parent.message
+	}
 	v.statusArea.WriteLine(modeline, 0, 0, w, termbox.ColorBlack, termbox.ColorWhite)
 }
 
 // SetCursor sets the cursor to absolute coordinates in the file
 func (v *View) SetCursor(row, column int) {
-	// if buffer is empty, cursor can only be at 0,0
-	if v.target.back.Len() == 0 {
-		v.target.C.Column = 0
-		v.target.C.Line = 0
-	} else {
-		total := v.target.back.Lines()
-		if row >= total {
-			row = total - 1
-		}
-		line, err := v.target.back.GetLine(row)
-		if err != nil {
-			row = v.target.C.Line
-		}
-		l := len(line)
-		if l > 0 && line[l-1] == '\n' {
-			l -= 1
-		}
-		if column > l {
-			column = l
-		}
-		if column < 0 {
-			column = 0
-		}
-		v.target.C.Column = column
-		v.target.C.Line = row
+	if v.target.hex {
+		v.setHexOffset(int64(row)*HexRowBytes + int64(column))
+		return
 	}
-	h, _ := v.target.area.Size()
+	v.target.C = v.target.clamp(row, column)
+	v.scrollToCursor()
+}
+
+// scrollToCursor scrolls the target so that its cursor can be seen
+func (v *View) scrollToCursor() {
+	v.target.scroll()
+}
+
+// scroll scrolls the subview so that its cursor can be seen, and notes
+// where in the text the cursor now is
+func (s *subview) scroll() {
+	if s.at != nil {
+		s.at.off = s.offsetOf(s.C)
+	}
+	h, _ := s.area.Size()
 	h = h - 1
-	if v.target.C.Line < v.target.firstLine {
-		v.target.firstLine = v.target.C.Line
-	} else if v.target.C.Line >= v.target.firstLine+h-1 {
-		v.target.firstLine = v.target.C.Line - h + 1
+	if s.C.Line < s.firstLine {
+		s.firstLine = s.C.Line
+	} else if s.C.Line >= s.firstLine+h-1 {
+		s.firstLine = s.C.Line - h + 1
 	}
 }
 
-// MoveCursor moves the cursor relative to where it is now
+// MoveCursor moves the cursors relative to where they are now
 func (v *View) MoveCursor(dc, dr int) {
+	v.target.moveCursors(dc, dr)
 	v.SetCursor(v.target.C.Line+dr, v.target.C.Column+dc)
+	v.target.merge()
 }
 
 // SetMode sets a view's mode, so that it handles events per that mode
@@ -189,31 +261,81 @@ func (v *View) SetMode(m *Mode, n string) {
 
 // Do tells a view to handle a keypress according to its mode
 func (v *View) Do(k keys.Keypress) error {
+	if next := v.nextKey; next != nil {
+		v.nextKey = nil
+		return next(v, k)
+	}
 	f, ok := v.mode.EventMap[k]
 	if ok {
 		return f(v, 1)
 	}
+	if v.mode.Default != nil {
+		return v.mode.Default(v, k, 1)
+	}
 	LogItAll.Printf("No function bound to key %v", k)
 	return nil
 
 }
 
-// InsertChar inserts the single rune r at the cursor
-func (v *View) InsertChar(c byte) {
-	off := v.target.back.OffsetOf(v.target.C.Line, v.target.C.Column)
-	//LogItAll.Println("Inserting", c, "at", v.C.Line, v.C.Column, "giving an offset of", off)
-	v.target.back.WriteAt([]byte{c}, off)
+// NextKey has the next keypress the view gets passed to f, rather than
+// handled by its mode
+func (v *View) NextKey(f func(v *View, k keys.Keypress) error) {
+	v.nextKey = f
+}
 
+// namedByKey returns a ModeFunc that waits for a key, and then calls f with
+// the name that key gives. Names are printable keys; what says what they
+// name, for the error about other keys. Esc gives up.
+func namedByKey(what string, f func(v *View, name string, count int) error) ModeFunc {
+	return func(v *View, count int) error {
+		v.NextKey(func(v *View, k keys.Keypress) error {
+			r := rune(k.Key)
+			if k.Key == keys.Esc {
+				return nil
+			}
+			if k.Mod != 0 || !unicode.IsPrint(r) {
+				return fmt.Errorf("%s are named by printable keys, not %v", what, k)
+			}
+			return f(v, string(r), count)
+		})
+		return nil
+	}
 }
 
-// DeleteBackwards deletes one character backwards
+// InsertChar inserts the single rune r at each cursor, and moves the
+// cursors past it
+func (v *View) InsertChar(r rune) {
+	s := v.target
+	var b [utf8.UTFMax]byte
+	n := utf8.EncodeRune(b[:], r)
+	// the main cursor may have been put on another one
+	s.merge()
+	s.back.history.Begin()
+	for _, x := range s.extra {
+		s.back.WriteAt(b[:n], x.at.off)
+	}
+	off := s.offsetOf(s.C)
+	s.back.WriteAt(b[:n], off)
+	s.back.history.End()
+	c := s.cursorAt(off + int64(n))
+	v.SetCursor(c.Line, c.Column)
+	s.merge()
+}
+
+// DeleteBackwards deletes one character backwards at each cursor, moving the
+// cursors with them
 func (v *View) DeleteBackwards() {
-	offset := v.target.back.OffsetOf(v.target.C.Line, v.target.C.Column)
-	//LogItAll.Println("Delete:", v.C.Line, v.C.Column, offset-2)
-	if offset < 1 {
-		return
+	s := v.target
+	s.merge()
+	s.back.history.Begin()
+	for _, x := range s.extra {
+		s.deleteBefore(x.at.off)
 	}
-	v.target.back.Delete(1, offset-1)
+	start := s.deleteBefore(s.offsetOf(s.C))
+	s.back.history.End()
+	c := s.cursorAt(start)
+	v.SetCursor(c.Line, c.Column)
+	s.merge()
 }
 
 func (v *View) resultUnderCursor() ([]byte, error) {
@@ -224,19 +346,20 @@ func (v *View) resultUnderCursor() ([]byte, error) {
 
 	stdin := ""
 	if v.buffer.Point != nil {
-		off1 := v.buffer.back.OffsetOf(v.buffer.Point.Line, v.buffer.Point.Column)
-		off2 := v.buffer.back.OffsetOf(v.buffer.C.Line, v.buffer.C.Column)
+		off1 := v.buffer.Point.off
+		off2 := v.buffer.offsetOf(v.buffer.C)
 		stdin, _ = v.buffer.back.FromTo(off1, off2)
 	}
 	var i, j int
 
 	LogItAll.Println("In line:", string(line), "C:", v.target.C.Column)
+	at := columnOffset(line, v.target.C.Column)
 	for n, c := range string(line) {
-		if n < v.target.C.Column && unicode.IsSpace(c) {
+		if n < at && unicode.IsSpace(c) {
 			LogItAll.Println("setting i to", n)
 			i = n + 1
 		}
-		if n >= v.target.C.Column && unicode.IsSpace(c) {
+		if n >= at && unicode.IsSpace(c) {
 			LogItAll.Println("setting j to", n)
 			j = n
 			break
@@ -258,11 +381,38 @@ func (v *View) ExecInsertUnderCursor() error {
 		return err
 	}
 
-	v.buffer.back.WriteAt(toIns,
-		v.buffer.back.OffsetOf(v.buffer.C.Line, v.buffer.C.Column))
+	v.buffer.back.WriteAt(toIns, v.buffer.offsetOf(v.buffer.C))
 	return nil
 }
 
+// Undo undoes the last change to the target buffer and moves the cursor to it
+func (v *View) Undo() {
+	v.travel(v.target.back.Undo())
+}
+
+// Redo redoes the last undone change to the target buffer and moves the
+// cursor to it
+func (v *View) Redo() {
+	v.travel(v.target.back.Redo())
+}
+
+// travel moves the cursor to where a trip through the history changed the
+// target buffer, if it did
+func (v *View) travel(off int64) {
+	if off != -1 {
+		c := v.target.cursorAt(off)
+		v.SetCursor(c.Line, c.Column)
+	}
+}
+
+// Choose runs the view's choose function for the line the cursor is on
+func (v *View) Choose() error {
+	if v.choose == nil {
+		return nil
+	}
+	return v.choose(v.buffer.C.Line)
+}
+
 func (v *View) TogglePoint() {
 	if v.target.Point == nil {
 		v.SetPoint()
@@ -272,23 +422,84 @@ func (v *View) TogglePoint() {
 }
 
 func (v *View) SetPoint() {
-	c := v.target.C
-	v.target.Point = &c
+	v.ClearPoint()
+	v.target.Point = v.target.back.newMark(v.target.offsetOf(v.target.C))
 }
 
 func (v *View) ClearPoint() {
+	if v.target.Point != nil {
+		v.target.back.dropMark(v.target.Point)
+	}
 	v.target.Point = nil
 }
 
-// InRegion returns true if
-func (s *subview) InRegion(l, c int) bool {
+// offsetOf returns the byte offset in the buffer of the cursor position c
+func (s *subview) offsetOf(c Cursor) int64 {
+	if s.hex {
+		return int64(c.Line)*HexRowBytes + int64(c.Column)
+	}
+	line, err := s.back.GetLine(c.Line)
+	if err != nil {
+		return s.back.OffsetOf(c.Line, 0)
+	}
+	return s.back.OffsetOf(c.Line, columnOffset(line, c.Column))
+}
+
+// cursorAt returns the cursor position of the byte offset off
+func (s *subview) cursorAt(off int64) Cursor {
+	if s.hex {
+		return Cursor{int(off / HexRowBytes), int(off % HexRowBytes)}
+	}
+	return cursorAt(s.back, off)
+}
+
+// onScreen reports whether cell x, y of the screen is in the subview's area
+func (s *subview) onScreen(x, y int) bool {
+	return x >= s.x && x < s.x+s.w && y >= s.y && y < s.y+s.h
+}
+
+// cursorAtCell returns the cursor position drawn at cell x, y of the
+// subview's area. Positions past the end of a line or of the buffer give
+// the nearest position that exists.
+func (s *subview) cursorAtCell(x, y int) Cursor {
+	row := s.firstLine + y
+	if s.hex {
+		col := x - hexASCIIX
+		if col < 0 {
+			col = HexRowBytes - 1
+			for col > 0 && hexX(col) > x {
+				col--
+			}
+		}
+		if col >= HexRowBytes {
+			col = HexRowBytes - 1
+		}
+		return Cursor{row, col}
+	}
+	if n := s.back.Lines(); row >= n {
+		row = n - 1
+	}
+	if row < 0 {
+		return Cursor{0, 0}
+	}
+	line, _ := s.back.GetLine(row)
+	return Cursor{row, columnAtCell(line, x, s.back.tabWidth)}
+}
+
+// region returns the offsets of the first and last bytes of the selection,
+// and whether there is one
+func (s *subview) region() (int64, int64, bool) {
 	if s.Point == nil {
-		return false
+		return 0, 0, false
 	}
-	m := s.back.OffsetOf(s.Point.Line, s.Point.Column)
-	o := s.back.OffsetOf(s.C.Line, s.C.Column)
-	i := s.back.OffsetOf(l, c)
-	return m <= i && i <= o
+	return s.Point.off, s.offsetOf(s.C), true
+}
+
+// InRegion returns true if the given line and column is in the selection
+func (s *subview) InRegion(l, c int) bool {
+	m, o, ok := s.region()
+	i := s.offsetOf(Cursor{l, c})
+	return ok && m <= i && i <= o
 }
 
 func (v *View) AlternateTag() {
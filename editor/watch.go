@@ -0,0 +1,226 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PollInterval is how often files are checked for changes when the system
+// can't tell jk about them
+const PollInterval = time.Second
+
+// A watcher reports the paths of watched files that may have changed
+type watcher interface {
+	Add(path string) error
+	Changes() <-chan string
+	Close() error
+}
+
+// An Event is something that happened outside of the editor, such as a file
+// changing on disk. Events are received from Editor.Events and passed to
+// Editor.Handle.
+type Event struct {
+	path string // a file that may have changed
+	tick bool   // time has passed
+}
+
+// Events returns the channel events the editor should handle arrive on
+func (e *Editor) Events() <-chan Event {
+	return e.events
+}
+
+// Handle deals with an event from Events. It must be called from the same
+// goroutine as Do.
+func (e *Editor) Handle(ev Event) {
+	if ev.tick {
+		e.updateSwaps()
+		return
+	}
+	for _, d := range e.documents() {
+		if d.path == "" {
+			continue
+		}
+		if abs, _ := filepath.Abs(d.path); abs == ev.path {
+			e.fileChanged(d)
+		}
+	}
+}
+
+// fileChanged reloads d if its file has changed and d hasn't been
+// modified, and warns about the conflict if it has
+func (e *Editor) fileChanged(d *document) {
+	changed, err := d.changedOnDisk(d.path)
+	if err != nil {
+		e.Message(err)
+		return
+	}
+	if !changed {
+		return
+	}
+	if d.modified() {
+		// warn once about each version of the file, not once in all
+		fi, err := os.Stat(d.path)
+		if err != nil {
+			e.Message(err)
+			return
+		}
+		if now := unsummedStamp(fi); now != d.conflict {
+			d.conflict = now
+			e.Message(errChangedOnDisk(d.path))
+		}
+		return
+	}
+	if err := e.reload(d); err != nil {
+		e.Message(err)
+	}
+}
+
+// reload reloads d from its file, telling the user whether its undo
+// history was kept
+func (e *Editor) reload(d *document) error {
+	if err := d.Reload(); err != nil {
+		return err
+	}
+	if d.large {
+		e.Message(d.path, " reloaded; large files can't keep their undo history")
+	} else {
+		e.Message(d.path, " reloaded")
+	}
+	return nil
+}
+
+// watch starts watching the file of d for changes, if watching is on
+func (e *Editor) watch(d *document) {
+	if !e.options.AutoReload || d.path == "" {
+		return
+	}
+	if e.watcher == nil {
+		e.watcher = newWatcher()
+		go func(changes <-chan string) {
+			for path := range changes {
+				select {
+				case e.events <- Event{path: path}:
+				case <-e.done:
+					return
+				}
+			}
+		}(e.watcher.Changes())
+	}
+	if err := e.watcher.Add(d.path); err != nil {
+		e.Message("Watching ", d.path, ": ", err)
+	}
+}
+
+// tick sends a tick event every interval, so that work like writing swap
+// files happens even while no keys are pressed, until the editor is closed
+func (e *Editor) tick(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-e.done:
+			return
+		}
+		select {
+		case e.events <- Event{tick: true}:
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// Close stops the work the editor does in the background, ticking and
+// watching files. Events aren't sent after Close.
+func (e *Editor) Close() {
+	close(e.done)
+	if e.watcher != nil {
+		e.watcher.Close()
+	}
+}
+
+// A poller watches files by checking them every PollInterval
+type poller struct {
+	mu      sync.Mutex
+	files   map[string]os.FileInfo
+	changes chan string
+	done    chan struct{}
+}
+
+func newPoller() *poller {
+	p := &poller{
+		files:   make(map[string]os.FileInfo),
+		changes: make(chan string),
+		done:    make(chan struct{}),
+	}
+	go p.poll()
+	return p
+}
+
+// Add starts watching the file at path
+func (p *poller) Add(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	fi, _ := os.Stat(abs)
+	p.mu.Lock()
+	p.files[abs] = fi
+	p.mu.Unlock()
+	return nil
+}
+
+// Changes returns the channel the paths of changed files are sent on
+func (p *poller) Changes() <-chan string {
+	return p.changes
+}
+
+// Close stops the poller
+func (p *poller) Close() error {
+	close(p.done)
+	return nil
+}
+
+func (p *poller) poll() {
+	t := time.NewTicker(PollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-p.done:
+			return
+		}
+		var changed []string
+		p.mu.Lock()
+		for path, old := range p.files {
+			fi, _ := os.Stat(path)
+			if !sameFile(old, fi) {
+				p.files[path] = fi
+				changed = append(changed, path)
+			}
+		}
+		p.mu.Unlock()
+		for _, path := range changed {
+			select {
+			case p.changes <- path:
+			case <-p.done:
+				return
+			}
+		}
+	}
+}
+
+// sameFile reports whether a and b, either of which may be nil if the file
+// didn't exist, describe the same version of a file
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime()) && os.SameFile(a, b)
+}
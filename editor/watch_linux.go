@@ -0,0 +1,127 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// newWatcher returns an inotify watcher, or a poller if inotify can't be used
+func newWatcher() watcher {
+	w, err := newInotify()
+	if err != nil {
+		LogItAll.Println("inotify unavailable, polling for changes:", err)
+		return newPoller()
+	}
+	return w
+}
+
+// Files are often saved by writing a new file and renaming it over the old
+// one, so the directories holding watched files are watched rather than the
+// files themselves.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO |
+	syscall.IN_CREATE | syscall.IN_DELETE
+
+// An inotify watches files with Linux's inotify
+type inotify struct {
+	fd      int
+	file    *os.File // fd, read through Go's poller so that Close interrupts it
+	mu      sync.Mutex
+	dirs    map[int]string // directories, by watch descriptor
+	watched map[string]int // watch descriptors, by directory
+	files   map[string]bool
+	changes chan string
+	done    chan struct{}
+}
+
+func newInotify() (*inotify, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &inotify{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		dirs:    make(map[int]string),
+		watched: make(map[string]int),
+		files:   make(map[string]bool),
+		changes: make(chan string),
+		done:    make(chan struct{}),
+	}
+	go w.read()
+	return w, nil
+}
+
+// Add starts watching the file at path
+func (w *inotify) Add(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(abs)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.watched[dir]; !ok {
+		wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+		if err != nil {
+			return err
+		}
+		w.dirs[wd] = dir
+		w.watched[dir] = wd
+	}
+	w.files[abs] = true
+	return nil
+}
+
+// Changes returns the channel the paths of changed files are sent on
+func (w *inotify) Changes() <-chan string {
+	return w.changes
+}
+
+// Close stops watching, which ends the read loop
+func (w *inotify) Close() error {
+	close(w.done)
+	return w.file.Close()
+}
+
+func (w *inotify) read() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil || n <= 0 {
+			select {
+			case <-w.done:
+			default:
+				LogItAll.Println("inotify read:", err)
+			}
+			return
+		}
+		var changed []string
+		w.mu.Lock()
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[start:start+int(ev.Len)], "\x00"))
+			path := filepath.Join(w.dirs[int(ev.Wd)], name)
+			if w.files[path] {
+				changed = append(changed, path)
+			}
+			off = start + int(ev.Len)
+		}
+		w.mu.Unlock()
+		for _, path := range changed {
+			select {
+			case w.changes <- path:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package editor
+
+// newWatcher returns a poller, as there's no way to be told about changes
+func newWatcher() watcher {
+	return newPoller()
+}
@@ -0,0 +1,84 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "file.txt")
+	os.WriteFile(name, []byte("one\n"), 0644)
+
+	for _, w := range []watcher{newWatcher(), newPoller()} {
+		if err := w.Add(name); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(name, []byte("one\ntwo\n"), 0644)
+		select {
+		case got := <-w.Changes():
+			if want, _ := filepath.Abs(name); got != want {
+				t.Errorf("%T reported %q changing, not %q", w, got, want)
+			}
+		case <-time.After(5 * PollInterval):
+			t.Errorf("%T didn't report a change", w)
+		}
+		w.Close()
+	}
+}
+
+func TestFileChanged(t *testing.T) {
+	dir := testCache(t)
+	name := filepath.Join(dir, "file.txt")
+	os.WriteFile(name, []byte("one\n"), 0644)
+
+	e := &Editor{}
+	b, _ := BufferizeFile(name)
+	d := b.(*document)
+
+	os.WriteFile(name, []byte("one\ntwo\n"), 0644)
+	e.fileChanged(d)
+	if got, _ := d.Get(); got != "one\ntwo\n" {
+		t.Errorf("Unmodified buffer has %q after its file changed", got)
+	}
+
+	d.WriteAt([]byte("zero\n"), 0)
+	os.WriteFile(name, []byte("three\n"), 0644)
+	e.fileChanged(d)
+	if got, _ := d.Get(); got != "zero\none\ntwo\n" {
+		t.Errorf("Modified buffer was reloaded to %q", got)
+	}
+	if e.message == "" {
+		t.Error("No warning about the conflict")
+	}
+
+	e.message = ""
+	e.fileChanged(d)
+	if e.message != "" {
+		t.Errorf("Warned again about the same conflict: %s", e.message)
+	}
+	os.WriteFile(name, []byte("three\nfour\n"), 0644)
+	e.fileChanged(d)
+	if e.message == "" {
+		t.Error("No warning about the file changing again")
+	}
+}
+
+func TestClose(t *testing.T) {
+	e := &Editor{events: make(chan Event), done: make(chan struct{})}
+	stopped := make(chan bool)
+	go func() {
+		e.tick(time.Millisecond)
+		close(stopped)
+	}()
+	<-e.Events()
+	e.watcher = newWatcher()
+	e.Close()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("Ticking went on after the editor was closed")
+	}
+}
@@ -2,43 +2,263 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// Package gapbuf implements a text buffer as a gap buffer.
+// Edits near the previous edit are cheap, as only the bytes between
+// the old and new edit positions have to be moved.
 package gapbuf
 
-import "github.com/millere/jk/line"
+import (
+	"bytes"
+	"fmt"
+	"io"
 
+	"github.com/millere/jk/atomicfile"
+)
+
+// DefaultGap is the size of the gap a buffer is created with
+const DefaultGap = 4096
+
+// A GapBuf is an array of bytes with a gap at the point of editing
 type GapBuf struct {
-	buffer    []*line.Line // backing array of bytes
-	gapStart  int          // index where gap starts (1 past last character)
-	gapEnd    int          // index where characters resume after gap
+	buffer    []byte // backing array of bytes
+	gapStart  int    // index where gap starts (1 past last character)
+	gapEnd    int    // index where characters resume after gap
 	readPoint int
+	fname     string
 }
 
+// New returns an empty GapBuf with a gap of the given size
 func New(size int) *GapBuf {
 	a := GapBuf{
-		buffer:   make([]*line.Line, size),
+		buffer:   make([]byte, size),
 		gapStart: 0,
 		gapEnd:   size,
 	}
 	return &a
 }
 
+// FromReader creates a GapBuf holding everything in r, with a gap of the
+// given size at the start
+func FromReader(r io.Reader, gap int) (*GapBuf, error) {
+	a := New(gap)
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, err
+	}
+	a.buffer = append(a.buffer, buf.Bytes()...)
+	return a, nil
+}
+
+// Load loads a buffer from a reader
+func (a *GapBuf) Load(from io.Reader, name string) error {
+	b, err := FromReader(from, DefaultGap)
+	if err != nil {
+		return fmt.Errorf("gapbuf.Load: %v", err)
+	}
+	*a = *b
+	a.fname = name
+	return nil
+}
+
 // Len gives the size of the GapBuffer without the gap
 func (a *GapBuf) Len() int {
 	return len(a.buffer) + a.gapStart - a.gapEnd
 }
 
 // At indexes the gapbuffer
-func (a *GapBuf) At(i int) *line.Line {
+func (a *GapBuf) At(i int) byte {
 	if i >= a.gapStart {
 		return a.buffer[i+a.gapEnd-a.gapStart]
-	} else {
-		return a.buffer[i]
 	}
+	return a.buffer[i]
 }
 
-// Insert inserts rune r at index i
-func (a *GapBuf) Insert(r rune, i int) {
+// Read implements io.Reader, reading the contents from the start
+func (a *GapBuf) Read(p []byte) (int, error) {
+	if a.readPoint >= a.Len() {
+		return 0, io.EOF
+	}
+	n := a.copyOut(p, a.readPoint)
+	a.readPoint += n
+	return n, nil
+}
+
+// copyOut copies the contents starting at off into p, skipping the gap
+func (a *GapBuf) copyOut(p []byte, off int) int {
+	n := 0
+	if off < a.gapStart {
+		n = copy(p, a.buffer[off:a.gapStart])
+		off = a.gapStart
+	}
+	n += copy(p[n:], a.buffer[off-a.gapStart+a.gapEnd:])
+	return n
+}
+
+// Insert inserts p at index i
+func (a *GapBuf) Insert(p []byte, i int) {
+	if a.gapEnd-a.gapStart < len(p) {
+		a.grow(len(p))
+	}
+	a.moveGap(i)
+	copy(a.buffer[a.gapStart:], p)
+	a.gapStart += len(p)
+}
+
+// grow makes the gap large enough to hold at least n more bytes
+func (a *GapBuf) grow(n int) {
+	size := 2*len(a.buffer) + n
+	if size < DefaultGap {
+		size = DefaultGap
+	}
+	b := make([]byte, size)
+	copy(b, a.buffer[:a.gapStart])
+	tail := len(a.buffer) - a.gapEnd
+	copy(b[size-tail:], a.buffer[a.gapEnd:])
+	a.buffer = b
+	a.gapEnd = size - tail
 }
 
 func (a *GapBuf) moveGap(to int) {
+	switch {
+	case to < a.gapStart:
+		n := a.gapStart - to
+		copy(a.buffer[a.gapEnd-n:a.gapEnd], a.buffer[to:a.gapStart])
+		a.gapStart -= n
+		a.gapEnd -= n
+	case to > a.gapStart:
+		n := to - a.gapStart
+		copy(a.buffer[a.gapStart:a.gapStart+n], a.buffer[a.gapEnd:a.gapEnd+n])
+		a.gapStart += n
+		a.gapEnd += n
+	}
+}
+
+// WriteAt implements the io.WriterAt interface, inserting p at off
+func (a *GapBuf) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(a.Len()) {
+		return 0, fmt.Errorf("gapbuf.WriteAt: offset %d out of range", off)
+	}
+	a.Insert(p, int(off))
+	return len(p), nil
+}
+
+// Delete deletes n bytes forwards from off
+func (a *GapBuf) Delete(n, off int64) {
+	if off < 0 || off+n > int64(a.Len()) {
+		panic(fmt.Sprintf("gapbuf.Delete: %d bytes at %d out of range", n, off))
+	}
+	a.moveGap(int(off))
+	a.gapEnd += int(n)
+}
+
+// Lines returns the number of lines in the buffer
+func (a *GapBuf) Lines() int {
+	if a.Len() == 0 {
+		return 0
+	}
+	return bytes.Count(a.buffer[:a.gapStart], []byte{'\n'}) +
+		bytes.Count(a.buffer[a.gapEnd:], []byte{'\n'}) + 1
+}
+
+// indexNth returns the offset of the nth newline, or -1 if there is none
+func (a *GapBuf) indexNth(n int) int {
+	seen := 0
+	parts := []struct {
+		b    []byte
+		base int
+	}{
+		{a.buffer[:a.gapStart], 0},
+		{a.buffer[a.gapEnd:], a.gapStart},
+	}
+	for _, part := range parts {
+		for i := 0; ; {
+			j := bytes.IndexByte(part.b[i:], '\n')
+			if j == -1 {
+				break
+			}
+			if seen == n {
+				return part.base + i + j
+			}
+			seen++
+			i += j + 1
+		}
+	}
+	return -1
+}
+
+// lineStart returns the offset of the first byte of the given line
+func (a *GapBuf) lineStart(lineno int) int {
+	if lineno == 0 {
+		return 0
+	}
+	i := a.indexNth(lineno - 1)
+	if i == -1 {
+		return -1
+	}
+	return i + 1
+}
+
+// GetLine returns the nth line in the buffer, 0 indexed
+func (a *GapBuf) GetLine(lineno int) (string, error) {
+	start := a.lineStart(lineno)
+	if start == -1 {
+		return "", fmt.Errorf("Bad line request: %d", lineno)
+	}
+	end := a.indexNth(lineno)
+	if end == -1 {
+		end = a.Len() - 1
+	}
+	return a.slice(start, end+1), nil
+}
+
+// OffsetOf takes a cursor position with origin 0,0 and returns the byte offset
+// of that position in the buffer
+func (a *GapBuf) OffsetOf(line, column int) int64 {
+	start := a.lineStart(line)
+	if start == -1 {
+		return -1
+	}
+	return int64(start + column)
+}
+
+// slice returns the contents from i up to j as a string
+func (a *GapBuf) slice(i, j int) string {
+	if j <= i {
+		return ""
+	}
+	p := make([]byte, j-i)
+	a.copyOut(p, i)
+	return string(p)
+}
+
+// Get returns the entire contents of the buffer
+func (a *GapBuf) Get() (string, error) {
+	return a.slice(0, a.Len()), nil
+}
+
+// FromTo returns the text from off1 through off2, inclusive
+func (a *GapBuf) FromTo(off1, off2 int64) (string, error) {
+	if off1 < 0 || off2 >= int64(a.Len()) || off1 > off2+1 {
+		return "", fmt.Errorf("gapbuf.FromTo: bad range %d-%d", off1, off2)
+	}
+	return a.slice(int(off1), int(off2)+1), nil
+}
+
+// WriteTo writes the contents of the buffer to w
+func (a *GapBuf) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(a.buffer[:a.gapStart])
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(a.buffer[a.gapEnd:])
+	return int64(n + m), err
+}
+
+// Write atomically replaces the named file, or the file the buffer was
+// loaded from if name is empty, with the buffer's contents
+func (a *GapBuf) Write(name string) error {
+	if name == "" {
+		name = a.fname
+	}
+	return atomicfile.Write(name, a, 0666)
 }
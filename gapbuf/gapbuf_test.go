@@ -3,6 +3,7 @@ package gapbuf
 import (
 	"fmt"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -63,3 +64,54 @@ func TestRead(t *testing.T) {
 	}
 	fmt.Println(result)
 }
+
+func getBuff() *GapBuf {
+	a, _ := FromReader(strings.NewReader(`This is a line
+This is line 2
+This is line 3`), 2)
+	return a
+}
+
+func TestGetLine(t *testing.T) {
+	a := getBuff()
+	tests := []string{
+		"This is a line\n",
+		"This is line 2\n",
+		"This is line 3",
+	}
+
+	for i, expect := range tests {
+		if got, err := a.GetLine(i); got != expect || err != nil {
+			t.Errorf("Case %d: got %q, %v, expected %q", i, got, err, expect)
+		}
+	}
+	if got, err := a.GetLine(5); err == nil {
+		t.Errorf("Got line 5: %v", got)
+	}
+	if got := a.Lines(); got != 3 {
+		t.Errorf("Got %v lines, expected 3", got)
+	}
+}
+
+func TestWriteAtDelete(t *testing.T) {
+	a := getBuff()
+	a.WriteAt([]byte("hello"), 4)
+	a.WriteAt([]byte("bye"), a.OffsetOf(1, 0))
+	expect := "Thishello is a line\nbyeThis is line 2\nThis is line 3"
+	if got, _ := a.Get(); got != expect {
+		t.Errorf("Got %q, expected %q", got, expect)
+	}
+	if got, _ := a.GetLine(1); got != "byeThis is line 2\n" {
+		t.Errorf("Got line %q after moving the gap", got)
+	}
+
+	a.Delete(5, 4)
+	a.Delete(3, a.OffsetOf(1, 0))
+	expect = "This is a line\nThis is line 2\nThis is line 3"
+	if got, _ := a.Get(); got != expect {
+		t.Errorf("Got %q, expected %q", got, expect)
+	}
+	if got, _ := a.FromTo(5, 6); got != "is" {
+		t.Errorf("FromTo: got %q, expected %q", got, "is")
+	}
+}
@@ -23,8 +23,14 @@ func main() {
 	defer termbox.Close()
 
 	e := editor.New()
+	defer e.Close()
 	e.RegisterMode("normal", editor.Normal(e))
 	e.RegisterMode("insert", editor.Insert())
+	e.RegisterMode("hex", editor.Hex(e))
+	e.RegisterMode("hex-overwrite", editor.HexOverwrite())
+
+	mode := e.InputMode()
+	termbox.SetInputMode(mode)
 
 	if len(os.Args) > 1 {
 		err = e.AddFile(os.Args[1])
@@ -36,14 +42,39 @@ func main() {
 		e.NewEmptyFile()
 	}
 
+	input := make(chan termbox.Event)
+	go func() {
+		for {
+			input <- termbox.PollEvent()
+		}
+	}()
+
 	for {
+		if m := e.InputMode(); m != mode {
+			mode = m
+			termbox.SetInputMode(mode)
+		}
 		e.Draw()
 		termbox.Flush()
-		v := termbox.PollEvent()
-		k := keys.FromTermbox(v)
-		err := e.Do(k)
-		if err != nil {
-			return
+		select {
+		case v := <-input:
+			if v.Type == termbox.EventMouse {
+				// the left button moves the cursor, the right adds one
+				switch v.Key {
+				case termbox.MouseLeft:
+					e.Click(v.MouseX, v.MouseY, false)
+				case termbox.MouseRight:
+					e.Click(v.MouseX, v.MouseY, true)
+				}
+				continue
+			}
+			k := keys.FromTermbox(v)
+			err := e.Do(k)
+			if err != nil {
+				return
+			}
+		case ev := <-e.Events():
+			e.Handle(ev)
 		}
 	}
 }
@@ -0,0 +1,51 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mmapbuf
+
+import (
+	"errors"
+	"runtime/debug"
+)
+
+// ErrChanged is returned once the mapped file has been cut short or
+// rewritten in place by another program. Reading the part of a mapping
+// past the end of its file faults, which would otherwise crash.
+var ErrChanged = errors.New("mmapbuf: the mapped file was changed in place")
+
+// isFault reports whether r, recovered from a panic, comes from a fault
+// reading memory
+func isFault(r interface{}) bool {
+	_, ok := r.(interface{ Addr() uintptr })
+	return ok
+}
+
+// guard is deferred by methods that read the mapping, with the result of
+// debug.SetPanicOnFault(true), so that a fault panics rather than crashing.
+// It turns the panic into ErrChanged, which is stored in err if that isn't
+// nil, and leaves the buffer unusable.
+func (b *Buffer) guard(panicOnFault bool, err *error) {
+	debug.SetPanicOnFault(panicOnFault)
+	r := recover()
+	if r == nil {
+		return
+	}
+	if !isFault(r) {
+		panic(r)
+	}
+	b.err = ErrChanged
+	b.idx.stop()
+	if err != nil {
+		*err = ErrChanged
+	}
+}
+
+// Err returns ErrChanged if reading the mapped file has faulted, after which
+// the buffer's text can't be read, and nil otherwise
+func (b *Buffer) Err() error {
+	if b.err == nil && b.idx != nil && b.idx.faulted() {
+		b.err = ErrChanged
+	}
+	return b.err
+}
@@ -0,0 +1,132 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mmapbuf
+
+import (
+	"bytes"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+// ChunkSize is how many bytes of a file are indexed at a time
+const ChunkSize = 1 << 20
+
+// Stride is how many newlines go by between those whose offsets are kept.
+// Finding any other newline means scanning from the one before it.
+const Stride = 64
+
+// An index finds the newlines in a file. It is built a chunk at a time,
+// in the background or when a question needs more of it.
+type index struct {
+	mu      sync.Mutex
+	data    []byte
+	marks   []int64 // marks[i] is the offset of newline number i*Stride
+	seen    int     // the number of newlines in data[:scanned]
+	scanned int64
+	quit    bool
+	fault   bool // whether reading data faulted while building
+}
+
+func newIndex(data []byte) *index {
+	return &index{data: data}
+}
+
+// build indexes the whole file, a chunk at a time so that questions can be
+// answered in between. If the file is cut short under it, it stops.
+func (x *index) build() {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	for x.step() {
+	}
+}
+
+// step indexes the next chunk, and reports whether there is more to do
+func (x *index) step() (more bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			if !isFault(r) {
+				panic(r)
+			}
+			x.fault = true
+		}
+	}()
+	if x.quit || x.scanned == int64(len(x.data)) {
+		return false
+	}
+	x.scan()
+	return true
+}
+
+// faulted reports whether building the index faulted
+func (x *index) faulted() bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.fault
+}
+
+// stop stops build from indexing any more
+func (x *index) stop() {
+	x.mu.Lock()
+	x.quit = true
+	x.mu.Unlock()
+}
+
+// scan indexes the next chunk. x.mu must be held.
+func (x *index) scan() {
+	end := x.scanned + ChunkSize
+	if end > int64(len(x.data)) {
+		end = int64(len(x.data))
+	}
+	for i := x.scanned; ; {
+		j := bytes.IndexByte(x.data[i:end], '\n')
+		if j == -1 {
+			break
+		}
+		if x.seen%Stride == 0 {
+			x.marks = append(x.marks, i+int64(j))
+		}
+		x.seen++
+		i += int64(j) + 1
+	}
+	x.scanned = end
+}
+
+// count returns the number of newlines before off
+func (x *index) count(off int64) int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for x.scanned < off {
+		x.scan()
+	}
+	i := sort.Search(len(x.marks), func(i int) bool { return x.marks[i] >= off })
+	if i == 0 {
+		return 0
+	}
+	last := x.marks[i-1]
+	return (i-1)*Stride + 1 + bytes.Count(x.data[last+1:off], []byte{'\n'})
+}
+
+// newline returns the offset of newline number n, or -1 if there are
+// fewer newlines than that
+func (x *index) newline(n int) int64 {
+	if n < 0 {
+		return -1
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for x.seen <= n && x.scanned < int64(len(x.data)) {
+		x.scan()
+	}
+	if x.seen <= n {
+		return -1
+	}
+	pos := x.marks[n/Stride]
+	for i := 0; i < n%Stride; i++ {
+		pos += int64(bytes.IndexByte(x.data[pos+1:], '\n')) + 1
+	}
+	return pos
+}
@@ -0,0 +1,22 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+// +build !unix
+
+package mmapbuf
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the first size bytes of f, as there's no mmap to use
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
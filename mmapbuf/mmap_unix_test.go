@@ -0,0 +1,40 @@
+//go:build unix
+// +build unix
+
+package mmapbuf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTruncated(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&text, "line %d\n", i)
+	}
+	b := openFile(t, text.String())
+	last := b.Lines() - 2
+	if got, err := b.GetLine(last); got != "line 4999\n" || err != nil {
+		t.Fatalf("Last line: got %q, %v", got, err)
+	}
+
+	// truncate the file in place, as a shell's > does
+	if err := os.WriteFile(b.fname, []byte("short\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetLine(last); err != ErrChanged {
+		t.Errorf("Reading past the end of the truncated file gave %v", err)
+	}
+	if err := b.Err(); err != ErrChanged {
+		t.Errorf("Err gave %v after a fault", err)
+	}
+	if _, err := b.Get(); err != ErrChanged {
+		t.Errorf("Get gave %v after a fault", err)
+	}
+	if err := b.Write(""); err == nil {
+		t.Error("Wrote a buffer whose file was truncated")
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mmapbuf implements a text buffer for files too large to copy into
+// memory. The file is mapped rather than read, and the positions of its lines
+// are found in the background as they're needed. Edits never touch the
+// mapped file: like a piece table, inserted text goes into an overlay and the
+// text is described by a list of pieces of the file and the overlay.
+package mmapbuf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+
+	"github.com/millere/jk/atomicfile"
+)
+
+// A piece is a span of either the file or the add buffer
+type piece struct {
+	add bool  // whether the piece refers to the add buffer
+	off int64 // where in its buffer the piece starts
+	n   int64 // the length of the piece in bytes
+	nl  int   // the number of newlines in the piece, or -1 if not yet known
+}
+
+// A Buffer is a mapped file with edits laid over it
+type Buffer struct {
+	orig   []byte
+	unmap  func() error
+	idx    *index
+	add    []byte
+	pieces []piece
+	size   int64
+	fname  string
+	err    error // ErrChanged once reading the mapping has faulted
+}
+
+// Open maps the named file into a new Buffer, and starts indexing its lines
+func Open(name string) (*Buffer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	unmap := func() error { return nil }
+	if fi.Size() > 0 {
+		data, unmap, err = mapFile(f, fi.Size())
+		if err != nil {
+			return nil, fmt.Errorf("mmapbuf.Open: %v", err)
+		}
+	}
+	b := fromBytes(data)
+	b.unmap = unmap
+	b.fname = name
+	return b, nil
+}
+
+// fromBytes returns a Buffer whose original text is data, and starts
+// indexing it
+func fromBytes(data []byte) *Buffer {
+	b := &Buffer{orig: data, idx: newIndex(data), size: int64(len(data))}
+	if len(data) > 0 {
+		b.pieces = []piece{{off: 0, n: int64(len(data)), nl: -1}}
+	}
+	go b.idx.build()
+	return b
+}
+
+// Load replaces the buffer with the contents of a reader. The text is held
+// in memory, since a reader can't be mapped.
+func (b *Buffer) Load(from io.Reader, name string) error {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, from)
+	if err != nil {
+		return fmt.Errorf("mmapbuf.Load: %d bytes read, %v", n, err)
+	}
+	b.Close()
+	*b = *fromBytes(buf.Bytes())
+	b.fname = name
+	return nil
+}
+
+// Close unmaps the buffer's file. The buffer mustn't be used afterwards.
+func (b *Buffer) Close() error {
+	if b.idx != nil {
+		b.idx.stop()
+	}
+	if b.unmap == nil {
+		return nil
+	}
+	err := b.unmap()
+	b.unmap = nil
+	return err
+}
+
+// bytesOf returns the bytes p refers to
+func (b *Buffer) bytesOf(p piece) []byte {
+	if p.add {
+		return b.add[p.off : p.off+p.n]
+	}
+	return b.orig[p.off : p.off+p.n]
+}
+
+// newlines returns the number of newlines in the ith piece, working it out
+// if it isn't known yet
+func (b *Buffer) newlines(i int) int {
+	p := &b.pieces[i]
+	if p.nl == -1 {
+		p.nl = b.idx.count(p.off+p.n) - b.idx.count(p.off)
+	}
+	return p.nl
+}
+
+// locate returns the index of the piece containing off and how far into
+// that piece off is. An offset at the end of the text gives len(pieces).
+func (b *Buffer) locate(off int64) (int, int64) {
+	for i, p := range b.pieces {
+		if off < p.n {
+			return i, off
+		}
+		off -= p.n
+	}
+	return len(b.pieces), off
+}
+
+// split makes sure a piece boundary falls at off, and returns the index of
+// the piece starting there
+func (b *Buffer) split(off int64) int {
+	i, in := b.locate(off)
+	if in == 0 {
+		return i
+	}
+	p := b.pieces[i]
+	left := piece{add: p.add, off: p.off, n: in, nl: -1}
+	right := piece{add: p.add, off: p.off + in, n: p.n - in, nl: -1}
+	if p.add {
+		left.nl = bytes.Count(b.bytesOf(left), []byte{'\n'})
+		right.nl = p.nl - left.nl
+	}
+	b.pieces = append(b.pieces, piece{})
+	copy(b.pieces[i+2:], b.pieces[i+1:])
+	b.pieces[i] = left
+	b.pieces[i+1] = right
+	return i + 1
+}
+
+// WriteAt implements the io.WriterAt interface, inserting p at off
+func (b *Buffer) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > b.size {
+		return 0, fmt.Errorf("mmapbuf.WriteAt: offset %d out of range", off)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	np := piece{add: true, off: int64(len(b.add)), n: int64(len(p)), nl: bytes.Count(p, []byte{'\n'})}
+	b.add = append(b.add, p...)
+	b.size += int64(len(p))
+
+	i, in := b.locate(off)
+	// Typing extends the piece that was just added rather than adding more
+	if in == 0 && i > 0 {
+		if last := &b.pieces[i-1]; last.add && last.off+last.n == np.off {
+			last.n += np.n
+			last.nl += np.nl
+			return len(p), nil
+		}
+	}
+	i = b.split(off)
+	b.pieces = append(b.pieces, piece{})
+	copy(b.pieces[i+1:], b.pieces[i:])
+	b.pieces[i] = np
+	return len(p), nil
+}
+
+// Delete deletes n bytes forwards from off
+func (b *Buffer) Delete(n, off int64) {
+	if off < 0 || off+n > b.size {
+		panic(fmt.Sprintf("mmapbuf.Delete: %d bytes at %d out of range", n, off))
+	}
+	if n == 0 {
+		return
+	}
+	i := b.split(off)
+	j := b.split(off + n)
+	b.pieces = append(b.pieces[:i], b.pieces[j:]...)
+	b.size -= n
+}
+
+// Unedited reports whether the text is still exactly that of the mapped
+// file
+func (b *Buffer) Unedited() bool {
+	var off int64
+	for _, p := range b.pieces {
+		if p.add || p.off != off {
+			return false
+		}
+		off += p.n
+	}
+	return off == int64(len(b.orig))
+}
+
+// Len returns the number of bytes in the text
+func (b *Buffer) Len() int {
+	return int(b.size)
+}
+
+// Lines returns the number of lines in the text. Until the whole file has
+// been indexed, this waits for it to be.
+func (b *Buffer) Lines() (n int) {
+	defer b.guard(debug.SetPanicOnFault(true), nil)
+	if b.size == 0 || b.err != nil {
+		return 0
+	}
+	n = 1
+	for i := range b.pieces {
+		n += b.newlines(i)
+	}
+	return n
+}
+
+// lineStart returns the offset of the first byte of the given line,
+// or -1 if there is no such line. Only as much of the file as comes before
+// the line has to have been indexed.
+func (b *Buffer) lineStart(lineno int) int64 {
+	if lineno == 0 {
+		return 0
+	}
+	var off int64
+	for i, p := range b.pieces {
+		if !p.add {
+			// the lineno'th newline in the piece, if it's there
+			pos := b.idx.newline(b.idx.count(p.off) + lineno - 1)
+			if pos != -1 && pos < p.off+p.n {
+				return off + pos - p.off + 1
+			}
+			lineno -= b.newlines(i)
+			off += p.n
+			continue
+		}
+		if lineno > p.nl {
+			lineno -= p.nl
+			off += p.n
+			continue
+		}
+		text := b.bytesOf(p)
+		for j := 0; ; {
+			k := bytes.IndexByte(text[j:], '\n')
+			lineno--
+			if lineno == 0 {
+				return off + int64(j+k) + 1
+			}
+			j += k + 1
+		}
+	}
+	return -1
+}
+
+// slice returns the text from i up to j
+func (b *Buffer) slice(i, j int64) []byte {
+	out := make([]byte, 0, j-i)
+	k, in := b.locate(i)
+	for ; k < len(b.pieces) && int64(len(out)) < j-i; k++ {
+		text := b.bytesOf(b.pieces[k])[in:]
+		if rest := j - i - int64(len(out)); int64(len(text)) > rest {
+			text = text[:rest]
+		}
+		out = append(out, text...)
+		in = 0
+	}
+	return out
+}
+
+// GetLine returns the nth line in the text, 0 indexed
+func (b *Buffer) GetLine(lineno int) (line string, err error) {
+	defer b.guard(debug.SetPanicOnFault(true), &err)
+	if b.err != nil {
+		return "", b.err
+	}
+	start := b.lineStart(lineno)
+	if start == -1 {
+		return "", fmt.Errorf("Bad line request: %d", lineno)
+	}
+	end := b.lineStart(lineno + 1)
+	if end == -1 {
+		end = b.size
+	}
+	return string(b.slice(start, end)), nil
+}
+
+// OffsetOf takes a cursor position with origin 0,0 and returns the byte offset
+// of that position in the text
+func (b *Buffer) OffsetOf(line, column int) (off int64) {
+	defer b.guard(debug.SetPanicOnFault(true), nil)
+	if b.err != nil {
+		return -1
+	}
+	start := b.lineStart(line)
+	if start == -1 {
+		return -1
+	}
+	return start + int64(column)
+}
+
+// Get returns the entire text
+func (b *Buffer) Get() (text string, err error) {
+	defer b.guard(debug.SetPanicOnFault(true), &err)
+	if b.err != nil {
+		return "", b.err
+	}
+	return string(b.slice(0, b.size)), nil
+}
+
+// FromTo returns the text from off1 through off2, inclusive
+func (b *Buffer) FromTo(off1, off2 int64) (text string, err error) {
+	defer b.guard(debug.SetPanicOnFault(true), &err)
+	if b.err != nil {
+		return "", b.err
+	}
+	if off1 < 0 || off2 >= b.size || off1 > off2+1 {
+		return "", fmt.Errorf("mmapbuf.FromTo: bad range %d-%d", off1, off2)
+	}
+	return string(b.slice(off1, off2+1)), nil
+}
+
+// WriteTo writes the text to w
+func (b *Buffer) WriteTo(w io.Writer) (total int64, err error) {
+	defer b.guard(debug.SetPanicOnFault(true), &err)
+	if b.err != nil {
+		return 0, b.err
+	}
+	for _, p := range b.pieces {
+		n, err := w.Write(b.bytesOf(p))
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Write atomically replaces the named file, or the file the buffer was
+// loaded from if name is empty, with the text. The mapped file is replaced
+// rather than written over, so the buffer can go on using it.
+func (b *Buffer) Write(name string) error {
+	if name == "" {
+		name = b.fname
+	}
+	return atomicfile.Write(name, b, 0666)
+}
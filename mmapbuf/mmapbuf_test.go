@@ -0,0 +1,112 @@
+package mmapbuf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openFile(t *testing.T, text string) *Buffer {
+	name := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(name, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestGetLine(t *testing.T) {
+	b := openFile(t, "This is a line\nThis is line 2\nThis is line 3")
+	b.WriteAt([]byte("new\nline\n"), b.OffsetOf(1, 0))
+	tests := []string{
+		"This is a line\n",
+		"new\n",
+		"line\n",
+		"This is line 2\n",
+		"This is line 3",
+	}
+
+	for i, expect := range tests {
+		if got, err := b.GetLine(i); got != expect || err != nil {
+			t.Errorf("Case %d: got %q, %v, expected %q", i, got, err, expect)
+		}
+	}
+	if got, err := b.GetLine(5); err == nil {
+		t.Errorf("Got line 5: %q", got)
+	}
+	if got := b.Lines(); got != 5 {
+		t.Errorf("Got %v lines, expected 5", got)
+	}
+}
+
+func TestLargeFile(t *testing.T) {
+	var text strings.Builder
+	n := 3*Stride*ChunkSize/100 + 7
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&text, "line %d\n", i)
+	}
+	b := openFile(t, text.String())
+
+	for _, i := range []int{0, 1, Stride - 1, Stride, Stride + 1, n / 2, n - 1} {
+		want := fmt.Sprintf("line %d\n", i)
+		if got, err := b.GetLine(i); got != want || err != nil {
+			t.Errorf("Line %d: got %q, %v", i, got, err)
+		}
+	}
+	if got := b.Lines(); got != n+1 {
+		t.Errorf("Got %d lines, expected %d", got, n+1)
+	}
+
+	b.Delete(int64(len("line 0\n")), 0)
+	b.WriteAt([]byte("first\n"), b.OffsetOf(n/2, 0))
+	if got, _ := b.GetLine(n/2 - 1); got != fmt.Sprintf("line %d\n", n/2) {
+		t.Errorf("Before the insertion: got %q", got)
+	}
+	if got, _ := b.GetLine(n / 2); got != "first\n" {
+		t.Errorf("Inserted line: got %q", got)
+	}
+	if got, _ := b.GetLine(n - 1); got != fmt.Sprintf("line %d\n", n-1) {
+		t.Errorf("Last line: got %q", got)
+	}
+	if got := b.Lines(); got != n+1 {
+		t.Errorf("After editing got %d lines, expected %d", got, n+1)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	b := openFile(t, "one\ntwo\n")
+	b.WriteAt([]byte("zero\n"), 0)
+	b.Delete(4, b.OffsetOf(2, 0))
+	if err := b.Write(""); err != nil {
+		t.Fatal(err)
+	}
+	// the mapping outlives the file it was made from
+	if got, _ := b.Get(); got != "zero\none\n" {
+		t.Errorf("Buffer holds %q after writing", got)
+	}
+	if got, _ := os.ReadFile(b.fname); string(got) != "zero\none\n" {
+		t.Errorf("Wrote %q", got)
+	}
+}
+
+func TestUnedited(t *testing.T) {
+	b := openFile(t, "one\ntwo\n")
+	if !b.Unedited() {
+		t.Error("A freshly opened buffer is edited")
+	}
+	b.WriteAt([]byte("x"), 2)
+	b.Delete(1, 2)
+	if !b.Unedited() {
+		t.Error("Deleting what was inserted left the buffer edited")
+	}
+	b.Delete(4, 4)
+	if b.Unedited() {
+		t.Error("A buffer with its end deleted counts as unedited")
+	}
+}
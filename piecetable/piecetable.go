@@ -0,0 +1,288 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package piecetable implements a text buffer as a piece table.
+//
+// The text a Table is loaded with is never modified. Inserted text is
+// appended to a separate add buffer, and the document is described by a
+// list of pieces, each of which refers to a span of one of the two. Since
+// neither buffer's existing bytes ever change, a copy of the piece list is
+// a complete, stable view of the text at that moment.
+package piecetable
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/millere/jk/atomicfile"
+)
+
+// A piece is a span of either the original or the add buffer
+type piece struct {
+	add bool // whether the piece refers to the add buffer
+	off int  // where in its buffer the piece starts
+	n   int  // the length of the piece in bytes
+	nl  int  // the number of newlines in the piece
+}
+
+// text is a list of pieces along with the buffers they refer to.
+// It implements the read-only methods shared by Tables and Snapshots.
+type text struct {
+	orig   []byte
+	add    []byte
+	pieces []piece
+	size   int
+}
+
+// A Table is a piece table holding editable text
+type Table struct {
+	text
+	fname string
+}
+
+// A Snapshot is an unchanging view of the text of a Table at some moment.
+type Snapshot struct {
+	text
+}
+
+// New returns an empty Table
+func New() *Table {
+	return new(Table)
+}
+
+// FromBytes returns a Table whose original text is b.
+// b must not be modified afterwards.
+func FromBytes(b []byte) *Table {
+	t := New()
+	t.orig = b
+	if len(b) > 0 {
+		t.pieces = []piece{{off: 0, n: len(b), nl: bytes.Count(b, []byte{'\n'})}}
+	}
+	t.size = len(b)
+	return t
+}
+
+// Load loads a buffer from a reader
+func (t *Table) Load(from io.Reader, name string) error {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, from)
+	if err != nil {
+		return fmt.Errorf("piecetable.Load: %d bytes read, %v", n, err)
+	}
+	*t = *FromBytes(buf.Bytes())
+	t.fname = name
+	return nil
+}
+
+// Snapshot returns a view of the current text of the table which later
+// edits do not affect. It costs time proportional to the number of pieces.
+func (t *Table) Snapshot() *Snapshot {
+	s := &Snapshot{t.text}
+	s.pieces = append([]piece(nil), t.pieces...)
+	return s
+}
+
+// Restore sets the text of the table back to what it was when s was taken.
+// s must have been taken from t.
+func (t *Table) Restore(s *Snapshot) {
+	t.pieces = append(t.pieces[:0:0], s.pieces...)
+	t.size = s.size
+}
+
+// bytesOf returns the bytes p refers to
+func (x *text) bytesOf(p piece) []byte {
+	if p.add {
+		return x.add[p.off : p.off+p.n]
+	}
+	return x.orig[p.off : p.off+p.n]
+}
+
+// locate returns the index of the piece containing off and how far into
+// that piece off is. An offset at the end of the text gives len(pieces).
+func (x *text) locate(off int) (int, int) {
+	for i, p := range x.pieces {
+		if off < p.n {
+			return i, off
+		}
+		off -= p.n
+	}
+	return len(x.pieces), off
+}
+
+// split makes sure a piece boundary falls at off, and returns the index of
+// the piece starting there
+func (t *Table) split(off int) int {
+	i, in := t.locate(off)
+	if in == 0 {
+		return i
+	}
+	p := t.pieces[i]
+	left := piece{add: p.add, off: p.off, n: in}
+	left.nl = bytes.Count(t.bytesOf(left), []byte{'\n'})
+	right := piece{add: p.add, off: p.off + in, n: p.n - in, nl: p.nl - left.nl}
+	t.pieces = append(t.pieces, piece{})
+	copy(t.pieces[i+2:], t.pieces[i+1:])
+	t.pieces[i] = left
+	t.pieces[i+1] = right
+	return i + 1
+}
+
+// WriteAt implements the io.WriterAt interface, inserting p at off
+func (t *Table) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(t.size) {
+		return 0, fmt.Errorf("piecetable.WriteAt: offset %d out of range", off)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	np := piece{add: true, off: len(t.add), n: len(p), nl: bytes.Count(p, []byte{'\n'})}
+	t.add = append(t.add, p...)
+	t.size += len(p)
+
+	i, in := t.locate(int(off))
+	// Typing extends the piece that was just added rather than adding more
+	if in == 0 && i > 0 {
+		if last := &t.pieces[i-1]; last.add && last.off+last.n == np.off {
+			last.n += np.n
+			last.nl += np.nl
+			return len(p), nil
+		}
+	}
+	i = t.split(int(off))
+	t.pieces = append(t.pieces, piece{})
+	copy(t.pieces[i+1:], t.pieces[i:])
+	t.pieces[i] = np
+	return len(p), nil
+}
+
+// Delete deletes n bytes forwards from off
+func (t *Table) Delete(n, off int64) {
+	if off < 0 || off+n > int64(t.size) {
+		panic(fmt.Sprintf("piecetable.Delete: %d bytes at %d out of range", n, off))
+	}
+	if n == 0 {
+		return
+	}
+	i := t.split(int(off))
+	j := t.split(int(off + n))
+	t.pieces = append(t.pieces[:i], t.pieces[j:]...)
+	t.size -= int(n)
+}
+
+// Len returns the number of bytes in the text
+func (x *text) Len() int {
+	return x.size
+}
+
+// Lines returns the number of lines in the text
+func (x *text) Lines() int {
+	if x.size == 0 {
+		return 0
+	}
+	n := 1
+	for _, p := range x.pieces {
+		n += p.nl
+	}
+	return n
+}
+
+// lineStart returns the offset of the first byte of the given line,
+// or -1 if there is no such line
+func (x *text) lineStart(lineno int) int {
+	if lineno == 0 {
+		return 0
+	}
+	off := 0
+	for _, p := range x.pieces {
+		if lineno > p.nl {
+			lineno -= p.nl
+			off += p.n
+			continue
+		}
+		b := x.bytesOf(p)
+		for i := 0; ; {
+			j := bytes.IndexByte(b[i:], '\n')
+			lineno--
+			if lineno == 0 {
+				return off + i + j + 1
+			}
+			i += j + 1
+		}
+	}
+	return -1
+}
+
+// slice returns the text from i up to j
+func (x *text) slice(i, j int) []byte {
+	out := make([]byte, 0, j-i)
+	k, in := x.locate(i)
+	for ; k < len(x.pieces) && len(out) < j-i; k++ {
+		b := x.bytesOf(x.pieces[k])[in:]
+		if rest := j - i - len(out); len(b) > rest {
+			b = b[:rest]
+		}
+		out = append(out, b...)
+		in = 0
+	}
+	return out
+}
+
+// GetLine returns the nth line in the text, 0 indexed
+func (x *text) GetLine(lineno int) (string, error) {
+	start := x.lineStart(lineno)
+	if start == -1 {
+		return "", fmt.Errorf("Bad line request: %d", lineno)
+	}
+	end := x.lineStart(lineno + 1)
+	if end == -1 {
+		end = x.size
+	}
+	return string(x.slice(start, end)), nil
+}
+
+// OffsetOf takes a cursor position with origin 0,0 and returns the byte offset
+// of that position in the text
+func (x *text) OffsetOf(line, column int) int64 {
+	start := x.lineStart(line)
+	if start == -1 {
+		return -1
+	}
+	return int64(start + column)
+}
+
+// Get returns the entire text
+func (x *text) Get() (string, error) {
+	return string(x.slice(0, x.size)), nil
+}
+
+// FromTo returns the text from off1 through off2, inclusive
+func (x *text) FromTo(off1, off2 int64) (string, error) {
+	if off1 < 0 || off2 >= int64(x.size) || off1 > off2+1 {
+		return "", fmt.Errorf("piecetable.FromTo: bad range %d-%d", off1, off2)
+	}
+	return string(x.slice(int(off1), int(off2)+1)), nil
+}
+
+// WriteTo writes the text to w
+func (x *text) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, p := range x.pieces {
+		n, err := w.Write(x.bytesOf(p))
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Write atomically replaces the named file, or the file it was loaded
+// from if name is empty, with the text
+func (t *Table) Write(name string) error {
+	if name == "" {
+		name = t.fname
+	}
+	return atomicfile.Write(name, t, 0666)
+}
@@ -0,0 +1,75 @@
+package piecetable
+
+import "testing"
+
+func getTable() *Table {
+	return FromBytes([]byte(`This is a line
+This is line 2
+This is line 3`))
+}
+
+func TestGetLine(t *testing.T) {
+	b := getTable()
+	b.WriteAt([]byte("new\nline\n"), b.OffsetOf(1, 0))
+	tests := []string{
+		"This is a line\n",
+		"new\n",
+		"line\n",
+		"This is line 2\n",
+		"This is line 3",
+	}
+
+	for i, expect := range tests {
+		if got, err := b.GetLine(i); got != expect || err != nil {
+			t.Errorf("Case %d: got %q, %v, expected %q", i, got, err, expect)
+		}
+	}
+	if got, err := b.GetLine(5); err == nil {
+		t.Errorf("Got line 5: %q", got)
+	}
+	if got := b.Lines(); got != 5 {
+		t.Errorf("Got %v lines, expected 5", got)
+	}
+}
+
+func TestEdits(t *testing.T) {
+	b := getTable()
+	for i, c := range "hello" {
+		b.WriteAt([]byte{byte(c)}, int64(4+i))
+	}
+	if len(b.pieces) != 3 {
+		t.Errorf("Typing made %d pieces, expected 3", len(b.pieces))
+	}
+	b.Delete(8, 2)
+	expect := "This a line\nThis is line 2\nThis is line 3"
+	if got, _ := b.Get(); got != expect {
+		t.Errorf("Got %q, expected %q", got, expect)
+	}
+	if got, _ := b.FromTo(1, 3); got != "his" {
+		t.Errorf("FromTo: got %q, expected %q", got, "his")
+	}
+	b.Delete(int64(b.Len()), 0)
+	if b.Len() != 0 || b.Lines() != 0 {
+		t.Errorf("Deleting everything left %d bytes, %d lines", b.Len(), b.Lines())
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	b := getTable()
+	s := b.Snapshot()
+	before, _ := s.Get()
+
+	b.WriteAt([]byte("xyz"), 3)
+	b.Delete(10, 20)
+	if got, _ := s.Get(); got != before {
+		t.Errorf("Snapshot changed to %q", got)
+	}
+	if got, _ := s.GetLine(2); got != "This is line 3" {
+		t.Errorf("Snapshot line 2 is %q", got)
+	}
+
+	b.Restore(s)
+	if got, _ := b.Get(); got != before {
+		t.Errorf("Restored %q, expected %q", got, before)
+	}
+}
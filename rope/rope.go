@@ -0,0 +1,356 @@
+// Copyright 2015 Ethan Miller. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rope implements a text buffer as a balanced rope.
+//
+// The text is held in the leaves of an AVL tree. Every node knows how many
+// bytes and newlines are beneath it, so finding a byte offset or the start
+// of a line takes time logarithmic in the size of the text. Nodes are never
+// modified once built, so a copy of the root is a stable view of the text.
+package rope
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/millere/jk/atomicfile"
+)
+
+// MaxLeaf is the largest number of bytes a leaf is built with
+const MaxLeaf = 1024
+
+type node struct {
+	left, right *node
+	leaf        []byte // the text of a leaf node, which has no children
+	size        int    // the number of bytes beneath this node
+	nl          int    // the number of newlines beneath this node
+	height      int    // 0 for leaves
+}
+
+func newLeaf(b []byte) *node {
+	if len(b) == 0 {
+		return nil
+	}
+	return &node{leaf: b, size: len(b), nl: bytes.Count(b, []byte{'\n'})}
+}
+
+func (n *node) isLeaf() bool {
+	return n.left == nil && n.right == nil
+}
+
+func height(n *node) int {
+	if n == nil {
+		return -1
+	}
+	return n.height
+}
+
+// mk makes an internal node with the given children
+func mk(l, r *node) *node {
+	h := l.height
+	if r.height > h {
+		h = r.height
+	}
+	return &node{
+		left:   l,
+		right:  r,
+		size:   l.size + r.size,
+		nl:     l.nl + r.nl,
+		height: h + 1,
+	}
+}
+
+// cat makes a node of two nodes of similar height, merging small leaves
+func cat(l, r *node) *node {
+	if l.isLeaf() && r.isLeaf() && l.size+r.size <= MaxLeaf {
+		b := make([]byte, 0, l.size+r.size)
+		b = append(append(b, l.leaf...), r.leaf...)
+		return newLeaf(b)
+	}
+	return mk(l, r)
+}
+
+func rotateLeft(n *node) *node {
+	r := n.right
+	return mk(mk(n.left, r.left), r.right)
+}
+
+func rotateRight(n *node) *node {
+	l := n.left
+	return mk(l.left, mk(l.right, n.right))
+}
+
+// join concatenates two balanced trees into one balanced tree
+func join(l, r *node) *node {
+	switch {
+	case l == nil:
+		return r
+	case r == nil:
+		return l
+	case l.height > r.height+1:
+		return joinRight(l, r)
+	case r.height > l.height+1:
+		return joinLeft(l, r)
+	}
+	return cat(l, r)
+}
+
+// joinRight joins r onto l, where l is the taller tree
+func joinRight(l, r *node) *node {
+	c := l.right
+	if c.height <= r.height+1 {
+		t := cat(c, r)
+		if t.height <= height(l.left)+1 {
+			return mk(l.left, t)
+		}
+		return rotateLeft(mk(l.left, rotateRight(t)))
+	}
+	t := joinRight(c, r)
+	if t.height <= height(l.left)+1 {
+		return mk(l.left, t)
+	}
+	return rotateLeft(mk(l.left, t))
+}
+
+// joinLeft joins l onto r, where r is the taller tree
+func joinLeft(l, r *node) *node {
+	c := r.left
+	if c.height <= l.height+1 {
+		t := cat(l, c)
+		if t.height <= height(r.right)+1 {
+			return mk(t, r.right)
+		}
+		return rotateRight(mk(rotateLeft(t), r.right))
+	}
+	t := joinLeft(l, c)
+	if t.height <= height(r.right)+1 {
+		return mk(t, r.right)
+	}
+	return rotateRight(mk(t, r.right))
+}
+
+// split divides a tree into the text before off and the text after it
+func split(n *node, off int) (*node, *node) {
+	switch {
+	case n == nil:
+		return nil, nil
+	case off <= 0:
+		return nil, n
+	case off >= n.size:
+		return n, nil
+	case n.isLeaf():
+		return newLeaf(n.leaf[:off]), newLeaf(n.leaf[off:])
+	case off < n.left.size:
+		l, r := split(n.left, off)
+		return l, join(r, n.right)
+	}
+	l, r := split(n.right, off-n.left.size)
+	return join(n.left, l), r
+}
+
+// build makes a balanced tree holding b, which must not be changed afterwards
+func build(b []byte) *node {
+	if len(b) <= MaxLeaf {
+		return newLeaf(b)
+	}
+	// keep leaves full by splitting on a multiple of MaxLeaf
+	mid := (len(b)/MaxLeaf + 1) / 2 * MaxLeaf
+	return mk(build(b[:mid]), build(b[mid:]))
+}
+
+// nthNewline returns the offset of the kth newline beneath n, 0 indexed
+func nthNewline(n *node, k int) int {
+	off := 0
+	for !n.isLeaf() {
+		if k < n.left.nl {
+			n = n.left
+		} else {
+			k -= n.left.nl
+			off += n.left.size
+			n = n.right
+		}
+	}
+	for i := 0; ; {
+		j := bytes.IndexByte(n.leaf[i:], '\n')
+		if k == 0 {
+			return off + i + j
+		}
+		k--
+		i += j + 1
+	}
+}
+
+// each calls f with the text from i up to j, one leaf at a time
+func each(n *node, i, j int, f func([]byte)) {
+	if n == nil || i >= j || j <= 0 || i >= n.size {
+		return
+	}
+	if n.isLeaf() {
+		if i < 0 {
+			i = 0
+		}
+		if j > n.size {
+			j = n.size
+		}
+		f(n.leaf[i:j])
+		return
+	}
+	each(n.left, i, j, f)
+	each(n.right, i-n.left.size, j-n.left.size, f)
+}
+
+// A Rope is a balanced tree of text
+type Rope struct {
+	root  *node
+	fname string
+}
+
+// New returns an empty Rope
+func New() *Rope {
+	return new(Rope)
+}
+
+// FromBytes returns a Rope holding b, which must not be modified afterwards
+func FromBytes(b []byte) *Rope {
+	return &Rope{root: build(b)}
+}
+
+// Load loads a buffer from a reader
+func (r *Rope) Load(from io.Reader, name string) error {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, from)
+	if err != nil {
+		return fmt.Errorf("rope.Load: %d bytes read, %v", n, err)
+	}
+	r.root = build(buf.Bytes())
+	r.fname = name
+	return nil
+}
+
+// Snapshot returns a Rope holding the current text, which later edits to
+// either rope do not affect. It takes constant time.
+func (r *Rope) Snapshot() *Rope {
+	s := *r
+	return &s
+}
+
+// Len returns the number of bytes in the rope
+func (r *Rope) Len() int {
+	if r.root == nil {
+		return 0
+	}
+	return r.root.size
+}
+
+// Lines returns the number of lines in the rope
+func (r *Rope) Lines() int {
+	if r.root == nil {
+		return 0
+	}
+	return r.root.nl + 1
+}
+
+// WriteAt implements the io.WriterAt interface, inserting p at off
+func (r *Rope) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(r.Len()) {
+		return 0, fmt.Errorf("rope.WriteAt: offset %d out of range", off)
+	}
+	b := make([]byte, len(p))
+	copy(b, p)
+	left, right := split(r.root, int(off))
+	r.root = join(join(left, build(b)), right)
+	return len(p), nil
+}
+
+// Delete deletes n bytes forwards from off
+func (r *Rope) Delete(n, off int64) {
+	if off < 0 || off+n > int64(r.Len()) {
+		panic(fmt.Sprintf("rope.Delete: %d bytes at %d out of range", n, off))
+	}
+	left, rest := split(r.root, int(off))
+	_, right := split(rest, int(n))
+	r.root = join(left, right)
+}
+
+// lineStart returns the offset of the first byte of the given line,
+// or -1 if there is no such line
+func (r *Rope) lineStart(lineno int) int {
+	switch {
+	case lineno == 0:
+		return 0
+	case lineno < 0 || r.root == nil || lineno > r.root.nl:
+		return -1
+	}
+	return nthNewline(r.root, lineno-1) + 1
+}
+
+// slice returns the text from i up to j
+func (r *Rope) slice(i, j int) []byte {
+	out := make([]byte, 0, j-i)
+	each(r.root, i, j, func(b []byte) {
+		out = append(out, b...)
+	})
+	return out
+}
+
+// GetLine returns the nth line in the rope, 0 indexed
+func (r *Rope) GetLine(lineno int) (string, error) {
+	start := r.lineStart(lineno)
+	if start == -1 {
+		return "", fmt.Errorf("Bad line request: %d", lineno)
+	}
+	end := r.lineStart(lineno + 1)
+	if end == -1 {
+		end = r.Len()
+	}
+	return string(r.slice(start, end)), nil
+}
+
+// OffsetOf takes a cursor position with origin 0,0 and returns the byte offset
+// of that position in the rope
+func (r *Rope) OffsetOf(line, column int) int64 {
+	start := r.lineStart(line)
+	if start == -1 {
+		return -1
+	}
+	return int64(start + column)
+}
+
+// Get returns the entire text
+func (r *Rope) Get() (string, error) {
+	return string(r.slice(0, r.Len())), nil
+}
+
+// FromTo returns the text from off1 through off2, inclusive
+func (r *Rope) FromTo(off1, off2 int64) (string, error) {
+	if off1 < 0 || off2 >= int64(r.Len()) || off1 > off2+1 {
+		return "", fmt.Errorf("rope.FromTo: bad range %d-%d", off1, off2)
+	}
+	return string(r.slice(int(off1), int(off2)+1)), nil
+}
+
+// WriteTo writes the text to w
+func (r *Rope) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	var err error
+	each(r.root, 0, r.Len(), func(b []byte) {
+		if err != nil {
+			return
+		}
+		var n int
+		n, err = w.Write(b)
+		total += int64(n)
+	})
+	return total, err
+}
+
+// Write atomically replaces the named file, or the file it was loaded
+// from if name is empty, with the text
+func (r *Rope) Write(name string) error {
+	if name == "" {
+		name = r.fname
+	}
+	return atomicfile.Write(name, r, 0666)
+}
@@ -0,0 +1,93 @@
+package rope
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// check verifies the sizes, counts and balance of the tree beneath n
+func check(t *testing.T, n *node) {
+	if n == nil || n.isLeaf() {
+		return
+	}
+	check(t, n.left)
+	check(t, n.right)
+	if n.size != n.left.size+n.right.size || n.nl != n.left.nl+n.right.nl {
+		t.Fatalf("Node counts don't match its children")
+	}
+	if d := n.left.height - n.right.height; d > 1 || d < -1 {
+		t.Fatalf("Node unbalanced: heights %d and %d", n.left.height, n.right.height)
+	}
+}
+
+func TestGetLine(t *testing.T) {
+	r := FromBytes([]byte(`This is a line
+This is line 2
+This is line 3`))
+	tests := []string{
+		"This is a line\n",
+		"This is line 2\n",
+		"This is line 3",
+	}
+
+	for i, expect := range tests {
+		if got, err := r.GetLine(i); got != expect || err != nil {
+			t.Errorf("Case %d: got %q, %v, expected %q", i, got, err, expect)
+		}
+	}
+	if got, err := r.GetLine(5); err == nil {
+		t.Errorf("Got line 5: %q", got)
+	}
+	if got := r.OffsetOf(1, 2); got != 17 {
+		t.Errorf("OffsetOf(1, 2) = %d, expected 17", got)
+	}
+}
+
+func TestRandomEdits(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	line := []byte("the quick brown fox\n")
+	expect := bytes.Repeat(line, 500)
+	r := FromBytes(append([]byte(nil), expect...))
+
+	for i := 0; i < 2000; i++ {
+		off := rnd.Intn(len(expect) + 1)
+		if rnd.Intn(3) == 0 && off < len(expect) {
+			n := rnd.Intn(len(expect)-off) % 50
+			r.Delete(int64(n), int64(off))
+			expect = append(expect[:off], expect[off+n:]...)
+		} else {
+			p := line[:rnd.Intn(len(line))]
+			r.WriteAt(p, int64(off))
+			expect = append(expect[:off], append(append([]byte(nil), p...), expect[off:]...)...)
+		}
+	}
+	check(t, r.root)
+
+	if got, _ := r.Get(); got != string(expect) {
+		t.Fatalf("Contents differ after edits")
+	}
+	lines := strings.SplitAfter(string(expect), "\n")
+	if r.Lines() != len(lines) {
+		t.Errorf("Got %d lines, expected %d", r.Lines(), len(lines))
+	}
+	for i, l := range lines {
+		if got, _ := r.GetLine(i); got != l {
+			t.Fatalf("Line %d: got %q, expected %q", i, got, l)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	r := FromBytes([]byte("hello, world"))
+	s := r.Snapshot()
+	r.Delete(5, 0)
+	r.WriteAt([]byte("goodbye"), 0)
+	if got, _ := s.Get(); got != "hello, world" {
+		t.Errorf("Snapshot changed to %q", got)
+	}
+	if got, _ := r.FromTo(0, 8); got != "goodbye, " {
+		t.Errorf("FromTo: got %q", got)
+	}
+}